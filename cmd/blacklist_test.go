@@ -12,9 +12,25 @@ func TestBuildBlacklists(t *testing.T) {
 		"repo:bar",
 		"something else",
 		"yada:yada",
+		"topic:deprecated",
+		"user:/^svc-/",
 	})
 
 	is := is.New(t)
-	is.Equal(users, []string{"foo", "something else", "yada:yada"})
-	is.Equal(repos, []string{"bar", "something else", "yada:yada"})
+	is.Equal(users, []string{"foo", "something else", "yada:yada", "/^svc-/"})
+	is.Equal(repos, []string{"bar", "something else", "yada:yada", "topic:deprecated"})
+}
+
+func TestBuildWhitelists(t *testing.T) {
+	users, repos := buildWhitelists([]string{
+		"user:foo",
+		"repo:bar",
+		"repo:someone/baz",
+		"something else",
+		"lang:Go",
+	})
+
+	is := is.New(t)
+	is.Equal(users, []string{"foo", "something else"})
+	is.Equal(repos, []string{"bar", "someone/baz", "lang:Go"})
 }
@@ -2,17 +2,26 @@ package cmd
 
 import (
 	"context"
+	"net/http"
 
+	"github.com/caarlos0/org-stats/httpcache"
 	"github.com/google/go-github/v39/github"
 	"golang.org/x/oauth2"
 )
 
-func newClient(ctx context.Context, token, baseURL string) (*github.Client, error) {
+func newClient(ctx context.Context, token, baseURL, cacheDir string) (*github.Client, error) {
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 
+	var httpClient *http.Client
+	if cacheDir != "" {
+		httpClient = &http.Client{Transport: httpcache.New(cacheDir, nil)}
+		// oauth2 uses the client from the context as its base transport
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	}
+
 	if baseURL == "" {
 		if token == "" {
-			return github.NewClient(nil), nil
+			return github.NewClient(httpClient), nil
 		} else {
 			return github.NewClient(oauth2.NewClient(ctx, ts)), nil
 		}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/org-stats/orgstats"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath is the config file loaded if it exists and --config
+// isn't given.
+const defaultConfigPath = "org-stats.yaml"
+
+var (
+	configPath string
+	aliases    []string
+)
+
+// loadConfigFile loads the config file at path into the given flags. A
+// missing file is only an error if it was asked for explicitly.
+func loadConfigFile(flags *pflag.FlagSet, path string, explicit bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+	if err := loadConfig(flags, f); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadConfig reads a yaml config whose keys are the names of the flags, and
+// sets the flags it configures, unless they were given in the command line.
+// Lists set flags that take several values, and the aliases key holds
+// lines in the format of the --identities file. All invalid keys and values
+// are reported.
+func loadConfig(flags *pflag.FlagSet, r io.Reader) error {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of options", root.Line)
+	}
+
+	var errs []error
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		values, err := scalars(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s: %w", key.Line, key.Value, err))
+			continue
+		}
+
+		if key.Value == "aliases" {
+			aliases = append(aliases, values...)
+			continue
+		}
+		flag := flags.Lookup(key.Value)
+		switch {
+		case key.Value == "token":
+			errs = append(errs, fmt.Errorf("line %d: token can't be set in the config file, use $GITHUB_TOKEN", key.Line))
+			continue
+		case flag == nil || key.Value == "config" || key.Value == "help":
+			errs = append(errs, fmt.Errorf("line %d: unknown key %q", key.Line, key.Value))
+			continue
+		case flag.Changed || windowOverridden(flags, key.Value):
+			// flags override the config file
+			continue
+		case value.Kind == yaml.SequenceNode && !strings.HasSuffix(flag.Value.Type(), "Slice") && !strings.HasSuffix(flag.Value.Type(), "Array"):
+			errs = append(errs, fmt.Errorf("line %d: %s takes a single value", key.Line, key.Value))
+			continue
+		}
+		for _, v := range values {
+			if err := flag.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: invalid value for %s: %w", key.Line, key.Value, err))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// windowOverridden checks whether the given time window key of the config
+// file is overridden by a flag of the other kind of window in the command
+// line: --from and --to override since, and --since overrides from and to.
+func windowOverridden(flags *pflag.FlagSet, key string) bool {
+	changed := func(name string) bool {
+		flag := flags.Lookup(name)
+		return flag != nil && flag.Changed
+	}
+	switch key {
+	case "since":
+		return changed("from") || changed("to")
+	case "from", "to":
+		return changed("since")
+	default:
+		return false
+	}
+}
+
+// scalars returns the values of a scalar or a list of scalars.
+func scalars(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		var values []string
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a list of values", item.Line)
+			}
+			values = append(values, item.Value)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("expected a value or a list of values")
+	}
+}
+
+// buildIdentities parses the identities file at path, if any, along with
+// the aliases of the config file.
+func buildIdentities(path string, aliases []string) (orgstats.IdentityMap, error) {
+	var identities orgstats.IdentityMap
+	if path == "" && len(aliases) == 0 {
+		return identities, nil
+	}
+
+	var r io.Reader = strings.NewReader("")
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return identities, fmt.Errorf("failed to open identities file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	identities, err := orgstats.ParseIdentities(io.MultiReader(r, strings.NewReader("\n"+strings.Join(aliases, "\n"))))
+	if err != nil {
+		return identities, fmt.Errorf("invalid identities: %w", err)
+	}
+	return identities, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manages org-stats config files",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validates a config file, reporting unknown keys and invalid values",
+	Long: `Validates a config file, reporting unknown keys and invalid values, such as bad blacklist and whitelist patterns and selectors.
+
+The config file is a yaml mapping whose keys are the names of the flags, e.g.:
+
+	org: [main, infra]
+	blacklist:
+	  - user:/^svc-/
+	  - topic:deprecated
+	since: 90d
+	include-reviews: true
+	csv-path: stats.csv
+	aliases:
+	  - carlos <carlos@old-laptop>
+	  - carlos-personal -> carlos
+
+It is validated as it would be run, so it needs organizations or repositories.`,
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := defaultConfigPath
+		if len(args) > 0 {
+			path = args[0]
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open config file: %w", err)
+		}
+		defer f.Close()
+
+		// the options are checked even if some keys are invalid, so all
+		// problems are reported at once
+		loadErr := loadConfig(rootCmd.Flags(), f)
+		_, optsErr := buildOptions()
+		if err := errors.Join(loadErr, optsErr); err != nil {
+			return fmt.Errorf("invalid config file %s:\n%w", path, err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), path, "is valid")
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/spf13/pflag"
+)
+
+func newTestFlags() (*pflag.FlagSet, *[]string, *bool, *int) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	orgs := flags.StringSlice("org", []string{}, "")
+	reviews := flags.Bool("include-reviews", false, "")
+	top := flags.Int("top", 3, "")
+	flags.String("token", "", "")
+	return flags, orgs, reviews, top
+}
+
+func TestLoadConfig(t *testing.T) {
+	is := is.New(t)
+	aliases = nil
+	defer func() { aliases = nil }()
+
+	flags, orgs, reviews, top := newTestFlags()
+	is.NoErr(flags.Parse([]string{"--top", "5"}))
+
+	is.NoErr(loadConfig(flags, strings.NewReader(`
+org: [main, infra]
+include-reviews: true
+top: 10
+aliases:
+  - carlos <carlos@old-laptop>
+`)))
+	is.Equal(*orgs, []string{"main", "infra"})
+	is.True(*reviews)
+	is.Equal(*top, 5) // flags override the config file
+	is.Equal(aliases, []string{"carlos <carlos@old-laptop>"})
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	is := is.New(t)
+	aliases = nil
+	defer func() { aliases = nil }()
+
+	flags, _, _, _ := newTestFlags()
+	err := loadConfig(flags, strings.NewReader(`
+orgs: [main]
+include-reviews: maybe
+top: [1, 2]
+token: secret
+`))
+	is.True(err != nil)
+	for _, msg := range []string{
+		`line 2: unknown key "orgs"`,
+		"line 3: invalid value for include-reviews",
+		"line 4: top takes a single value",
+		"line 5: token can't be set in the config file",
+	} {
+		is.True(strings.Contains(err.Error(), msg)) // missing error
+	}
+
+	is.True(loadConfig(flags, strings.NewReader("- main")) != nil)
+	is.NoErr(loadConfig(flags, strings.NewReader("")))
+}
+
+func TestLoadConfigWindow(t *testing.T) {
+	is := is.New(t)
+
+	newFlags := func() (*pflag.FlagSet, *string, *string, *string) {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		since := flags.String("since", "0s", "")
+		from := flags.String("from", "", "")
+		to := flags.String("to", "", "")
+		return flags, since, from, to
+	}
+	const config = "since: 90d\n"
+
+	// --from and --to override the since of the config file
+	flags, since, from, to := newFlags()
+	is.NoErr(flags.Parse([]string{"--from", "2026-07-01", "--to", "2026-09-30"}))
+	is.NoErr(loadConfig(flags, strings.NewReader(config)))
+	is.Equal(*since, "0s")
+	is.Equal(*from, "2026-07-01")
+	is.Equal(*to, "2026-09-30")
+
+	// --since overrides the from and to of the config file
+	flags, since, from, to = newFlags()
+	is.NoErr(flags.Parse([]string{"--since", "30d"}))
+	is.NoErr(loadConfig(flags, strings.NewReader("from: 2026-07-01\nto: 2026-09-30\n")))
+	is.Equal(*since, "30d")
+	is.Equal(*from, "")
+	is.Equal(*to, "")
+
+	// without window flags, the config file sets it
+	flags, since, _, _ = newFlags()
+	is.NoErr(flags.Parse(nil))
+	is.NoErr(loadConfig(flags, strings.NewReader(config)))
+	is.Equal(*since, "90d")
+}
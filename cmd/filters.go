@@ -1,14 +1,21 @@
 package cmd
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/caarlos0/org-stats/orgstats"
+)
 
 // buildBlacklists 将黑名单字符串列表转换为用户黑名单和仓库黑名单
+// topic:、lang: 等仓库选择器只作为仓库黑名单
 func buildBlacklists(blacklist []string) ([]string, []string) {
 	var userBlacklist []string
 	var repoBlacklist []string
 	for _, b := range blacklist {
 		if strings.HasPrefix(b, "user:") {
 			userBlacklist = append(userBlacklist, strings.TrimPrefix(b, "user:"))
+		} else if orgstats.IsRepoSelector(b) {
+			repoBlacklist = append(repoBlacklist, b)
 		} else if strings.HasPrefix(b, "repo:") {
 			repoBlacklist = append(repoBlacklist, strings.TrimPrefix(b, "repo:"))
 		} else {
@@ -20,17 +27,19 @@ func buildBlacklists(blacklist []string) ([]string, []string) {
 }
 
 // buildWhitelists 将白名单字符串列表转换为用户白名单和仓库白名单
+// 仓库白名单会限制扫描范围，因此没有前缀的条目只作为用户白名单
 func buildWhitelists(whitelist []string) ([]string, []string) {
 	var userWhitelist []string
 	var repoWhitelist []string
 	for _, w := range whitelist {
 		if strings.HasPrefix(w, "user:") {
 			userWhitelist = append(userWhitelist, strings.TrimPrefix(w, "user:"))
+		} else if orgstats.IsRepoSelector(w) {
+			repoWhitelist = append(repoWhitelist, w)
 		} else if strings.HasPrefix(w, "repo:") {
 			repoWhitelist = append(repoWhitelist, strings.TrimPrefix(w, "repo:"))
 		} else {
 			userWhitelist = append(userWhitelist, w)
-			repoWhitelist = append(repoWhitelist, w)
 		}
 	}
 	return userWhitelist, repoWhitelist
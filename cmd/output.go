@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/caarlos0/org-stats/csv"
+	"github.com/caarlos0/org-stats/json"
+	"github.com/caarlos0/org-stats/orgstats"
+)
+
+// writeOutputs writes the gathered stats to the --csv-path file, in the
+// format given by --format and grouped as given by --group-by and
+// --per-org, and to the --json-path file.
+func writeOutputs(csvW, jsonW io.Writer, stats orgstats.Stats, opts orgstats.Options) error {
+	var err error
+	switch format {
+	case "timeseries-csv":
+		err = csv.WriteTimeseries(csvW, stats)
+	case "json":
+		err = json.Write(csvW, stats, opts, perOrg)
+	default:
+		switch {
+		case groupBy == "team":
+			err = csv.WriteTeams(csvW, stats, opts)
+		case perOrg:
+			err = csv.WritePerOrg(csvW, stats, opts)
+		default:
+			err = csv.Write(csvW, stats, opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return json.Write(jsonW, stats, opts, perOrg)
+}
+
+// createFile creates or truncates the file at path, creating its parent
+// directories as needed.
+func createFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
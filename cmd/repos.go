@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// buildRepos returns the repositories given to --repos and in the
+// --repos-file, checking they are all full names (owner/name).
+func buildRepos(repos []string, path string) ([]string, error) {
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open repos file: %w", err)
+		}
+		defer f.Close()
+		fromFile, err := readRepos(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repos file %s: %w", path, err)
+		}
+		repos = append(repos, fromFile...)
+	}
+
+	for _, repo := range repos {
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid repository '%s', expected owner/name", repo)
+		}
+	}
+	return repos, nil
+}
+
+// readRepos reads one repository per line, ignoring blank lines and lines
+// starting with #.
+func readRepos(r io.Reader) ([]string, error) {
+	var repos []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		repos = append(repos, line)
+	}
+	return repos, scanner.Err()
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestBuildRepos(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "repos.txt")
+	is.NoErr(os.WriteFile(path, []byte("# product\nmain/app\n\n  infra/tf  \n"), 0o644))
+
+	repos, err := buildRepos([]string{"someone/lib"}, path)
+	is.NoErr(err)
+	is.Equal(repos, []string{"someone/lib", "main/app", "infra/tf"})
+
+	_, err = buildRepos([]string{"app"}, "")
+	is.True(err != nil) // missing owner
+
+	_, err = buildRepos([]string{"main/app/x"}, "")
+	is.True(err != nil) // not a repository
+
+	_, err = buildRepos(nil, filepath.Join(t.TempDir(), "missing.txt"))
+	is.True(err != nil) // missing file
+}
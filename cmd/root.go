@@ -2,30 +2,63 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"syscall"
 	"time"
 
 	"github.com/caarlos0/duration"
 	"github.com/caarlos0/org-stats/cmd/ui"
+	"github.com/caarlos0/org-stats/highlights"
+	"github.com/caarlos0/org-stats/orgstats"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 )
 
 var (
 	token          string
-	organization   string
+	organizations  []string
 	githubURL      string
 	since          string
+	from           string
+	to             string
 	csvPath        string
+	jsonPath       string
+	format         string
 	blacklist      []string
 	whitelist      []string // 白名单，允许包括指定的用户或项目，即使不属于组织
 	top            int
+	concurrency    int
 	includeReviews bool
+	reviewMembers  bool
+	includePRs     bool
+	includeIssues  bool
+	reviewDepth    bool
 	excludeForks   bool
 	verbose        bool // 是否启用详细日志
+	noTUI          bool
+	maxRetries     int
+	requestTimeout time.Duration
+	cacheDir       string
+	cloneDir       string
+	excludePaths   []string
+	includeBots    bool
+	botPatterns    []string
+	identitiesPath string
+	groupBy        string
+	team           string
+	perOrg         bool
+	repoList       []string
+	reposPath      string
+	allContribs    bool
+	noCache        bool
+	backend        string
 )
 
 func Execute() {
@@ -39,22 +72,48 @@ func init() {
 	rootCmd.Flags().StringVar(&token, "token", "", "github api token (default $GITHUB_TOKEN)")
 	_ = rootCmd.MarkFlagRequired(token)
 
-	rootCmd.Flags().StringVarP(&organization, "org", "o", "", "github organization to scan")
-	_ = rootCmd.MarkFlagRequired("org")
+	rootCmd.Flags().StringVar(&configPath, "config", defaultConfigPath, "path to a yaml file with the options to run with, overridden by flags")
+	rootCmd.Flags().StringSliceVarP(&organizations, "org", "o", []string{}, "github organizations to scan")
+	rootCmd.Flags().StringSliceVar(&repoList, "repos", []string{}, "repositories to scan instead of whole organizations, as owner/name")
+	rootCmd.Flags().StringVar(&reposPath, "repos-file", "", "path to a file with repositories to scan, one owner/name per line")
+	rootCmd.Flags().BoolVar(&allContribs, "all-contributors", false, "count all contributors, not only organization members and whitelisted users")
 
+	rootCmd.Flags().BoolVar(&includeBots, "include-bots", false, "include bot accounts in the stats, in a separate section of the csv")
+	rootCmd.Flags().StringArrayVar(&botPatterns, "bot-pattern", []string{}, "regular expression matching logins of bot accounts, e.g. '^ci-' (can be repeated)")
 	rootCmd.Flags().StringSliceVarP(&blacklist, "blacklist", "b", []string{}, "blacklist repos and/or users")
 	rootCmd.Flags().StringSliceVarP(&whitelist, "whitelist", "w", []string{}, "whitelist repos and/or users (even if not in organization)")
 	rootCmd.Flags().IntVar(&top, "top", 3, "how many users to show")
+	rootCmd.Flags().StringVar(&groupBy, "group-by", "user", "rank users or teams in the highlights and csv: user or team")
+	rootCmd.Flags().BoolVar(&perOrg, "per-org", false, "break the stats of each user down per organization in the csv and json outputs")
+	rootCmd.Flags().StringVar(&team, "team", "", "only gather stats of the members of the team with this slug")
+	rootCmd.Flags().StringVar(&identitiesPath, "identities", "", "path to a mailmap-like file mapping emails and alias logins to logins")
 	rootCmd.Flags().StringVar(&githubURL, "github-url", "", "custom github base url (if using github enterprise)")
 	rootCmd.Flags().StringVar(&since, "since", "0s", "time to look back to gather info (0s means everything)")
+	rootCmd.Flags().StringVar(&from, "from", "", "date to gather info from, as YYYY-MM-DD (overrides --since)")
+	rootCmd.Flags().StringVar(&to, "to", "", "date to gather info until, inclusive, as YYYY-MM-DD")
 	rootCmd.Flags().BoolVar(&includeReviews, "include-reviews", false, "include pull request reviews in the stats")
+	rootCmd.Flags().BoolVar(&reviewMembers, "reviews-of-all-members", false, "with --include-reviews, gather reviews of all organization members and whitelisted users, not only of contributors")
+	rootCmd.Flags().BoolVar(&reviewDepth, "include-review-depth", false, "include approvals, change requests, comment-only reviews and inline review comments in the stats")
+	rootCmd.Flags().BoolVar(&includePRs, "include-pull-requests", false, "include pull requests opened, merged and closed in the stats")
+	rootCmd.Flags().BoolVar(&includeIssues, "include-issues", false, "include issues opened, closed and commented on in the stats")
 	rootCmd.Flags().BoolVar(&excludeForks, "exclude-forks", false, "exclude forked repositories from the stats")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 4, "how many repositories to gather stats from in parallel")
+	rootCmd.Flags().StringVar(&backend, "backend", string(orgstats.BackendREST), "api used to gather stats: rest, graphql or git")
+	rootCmd.Flags().StringSliceVar(&excludePaths, "exclude-path", []string{}, "glob patterns of files whose lines are not counted, e.g. 'vendor/**,*.pb.go', with --backend git")
+	rootCmd.Flags().StringVar(&cloneDir, "clone-dir", "", "directory to keep the clones of the repositories in, with --backend git (default is org-stats-repos in the user cache directory)")
+	rootCmd.Flags().IntVar(&maxRetries, "max-retries", orgstats.DefaultRetryPolicy.MaxAttempts-1, "how many times to retry each api call while github is still computing stats, 0 to never retry")
+	rootCmd.Flags().DurationVar(&requestTimeout, "request-timeout", orgstats.DefaultRetryPolicy.Timeout, "timeout of each api call (0 means no timeout)")
 	rootCmd.Flags().StringVar(&csvPath, "csv-path", "", "path to write a csv file with all data collected")
+	rootCmd.Flags().StringVar(&format, "format", "csv", "format of the file written to --csv-path: csv, timeseries-csv or json")
+	rootCmd.Flags().StringVar(&jsonPath, "json-path", "", "path to write a json file with all data collected")
 	rootCmd.Flags().BoolVar(&verbose, "verbose", false, "enable verbose logging for debugging")
+	rootCmd.Flags().BoolVar(&noTUI, "no-tui", false, "print the results as plain text instead of using the interactive ui (default when not running in a terminal)")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to cache github api responses in (default is org-stats in the user cache directory)")
+	rootCmd.Flags().BoolVar(&noCache, "no-cache", false, "do not cache github api responses")
 
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
-	rootCmd.AddCommand(versionCmd, docsCmd, manCmd)
+	rootCmd.AddCommand(versionCmd, docsCmd, manCmd, configCmd)
 }
 
 var rootCmd = &cobra.Command{
@@ -63,46 +122,73 @@ var rootCmd = &cobra.Command{
 	Long: `org-stats can be used to get an overall sense of your org's contributors.
 
 It uses the GitHub API to grab the repositories in the given organization.
-Then, iterating one by one, it gets statistics of lines added, removed and number of commits of contributors.
+Then, iterating over them in parallel, it gets statistics of lines added, removed and number of commits of contributors.
 After that, if opted in, it does several searches to get the number of pull requests reviewed by each of the previously find contributors.
 Finally, it prints a rank by each category.
 
 
 Important notes:
 * GitHub's API rate limits for unauthenticated requests have been lowered significantly in the recent past. Using the ` + "`--token`" + ` option for compiling stats will speed up gathering of data considerably, since for authenticated requests it will be less likely that rate-limiting timelocks have to be awaited.
-* The ` + "`--since`" + ` filter does not work "that well" because GitHub summarizes thedata by week, so the data is not as granular as it should be.
-* The ` + "`--include-reviews`" + ` only grabs reviews from users that had contributions on the previous step.
+* The ` + "`--since`" + `, ` + "`--from`" + ` and ` + "`--to`" + ` filters do not work "that well" because GitHub summarizes thedata by week, so the data is not as granular as it should be, unless ` + "`--backend graphql`" + ` or ` + "`--backend git`" + ` is used.
+* The ` + "`--include-reviews`" + ` only grabs reviews from users that had contributions on the previous step, unless ` + "`--reviews-of-all-members`" + ` is used, in which case all organization members and whitelisted users are searched, which takes one search per member.
+* The ` + "`--include-review-depth`" + ` option goes through the pull requests of the scanned repositories, counting per reviewer the ones they approved, requested changes on or only commented on, as well as their inline review comments. It needs several API calls per pull request.
+* The ` + "`--include-pull-requests`" + ` option, likewise, only counts pull requests of users that had contributions. Closed pull requests are the ones closed without being merged.
+* The ` + "`--include-issues`" + ` option counts who opened, closed and commented on issues of the scanned repositories, so it includes users without commits. Pull requests are not counted as issues.
 * In the ` + "`--blacklist`" + ` option, 'foo' blacklists both the 'foo' user and 'foo' repo, while 'user:foo' blacklists only the user and 'repo:foo' only the repository.
-* The ` + "`--whitelist`" + ` option works similarly to blacklist but with the opposite effect - it includes users or repos even if they are not part of the organization. Use 'user:foo' to whitelist only the user and 'repo:foo' to whitelist only the repository.
+* Bot accounts are left out of the stats: accounts GitHub reports as bots, logins ending with '[bot]', such as 'dependabot[bot]', and logins matching any ` + "`--bot-pattern`" + ` regular expression, e.g. '^ci-' or '-bot$'. With ` + "`--include-bots`" + `, they are counted, and the csv lists them in a separate section after the users.
+* The ` + "`--whitelist`" + ` option includes users even if they are not part of the organization, 'foo' and 'user:foo' both whitelist the 'foo' user.
+* Using 'repo:foo' in ` + "`--whitelist`" + ` scans only the whitelisted repositories instead of the whole organization. Repositories outside the organization can be given as 'repo:owner/name'.
+* Entries of ` + "`--blacklist`" + ` and ` + "`--whitelist`" + ` may be glob patterns, e.g. 'repo:archive-*', or regular expressions between slashes, e.g. 'user:/^svc-/'. Repositories can also be selected by their metadata with 'topic:deprecated', 'lang:Go', 'visibility:private' and 'archived:true', whose values may be patterns too. Whitelisted patterns and selectors are matched against all repositories of the organizations, and whitelisted user patterns only match users that contributed.
+* The ` + "`--from`" + ` and ` + "`--to`" + ` options take absolute dates (e.g. 2021-07-01 and 2021-09-30), both inclusive, and can't be combined with ` + "`--since`" + `.
 * The ` + "`--since`" + ` option accepts all the regular time. Accepts any duration Go standard library accepts, plus a few more: 1y (365d), 1mo (30d), 1w (7d) and 1d (24h).
+* Responses from the GitHub API are cached on disk and revalidated with conditional requests, which don't count against the rate limit. Use ` + "`--no-cache`" + ` to disable it.
+* When not running in a terminal (e.g. in CI), or with ` + "`--no-tui`" + `, the results are printed as plain text instead and logs are written to stderr. Otherwise, logs are written to org-stats.log in the temporary directory.
+* GitHub computes contributor stats in the background, so they are retried with backoff up to ` + "`--max-retries`" + ` times. Repositories whose stats are still not ready are reported as pending and left out.
+* With ` + "`--backend graphql`" + `, commits are read one by one from the default branch of each repository through the GraphQL API, so the ` + "`--since`" + `, ` + "`--from`" + ` and ` + "`--to`" + ` filters are exact and match when commits were authored, merge commits are skipped and reviews are counted in batches. Commits are read 100 per call, so busy repositories take more calls than with the rest backend, which takes one per repository. It needs a token.
+* With ` + "`--backend git`" + `, each repository is mirror-cloned into ` + "`--clone-dir`" + ` and its default branch history is read with the git command line, which needs to be installed. Commits are counted one by one with the exact times they were authored and merge commits are skipped, without the limits of GitHub's contributor stats. Mirrors are kept and only fetched on later runs. Commits are attributed by author email, through ` + "`--identities`" + `, GitHub's noreply emails or else the account GitHub links to one commit of each email. Commits of emails that can't be attributed are left out and reported. Reviews are still searched through the API.
+* The ` + "`--exclude-path`" + ` option leaves out the lines added and removed in files matching the given patterns, such as vendored dependencies, generated code and lockfiles. Patterns without a slash match file names in any directory (e.g. '*.pb.go' or 'package-lock.json') and '**' matches any number of directories (e.g. 'vendor/**'). Commits are still counted. It needs ` + "`--backend git`" + `, as only the history of the repository has the changes of each file.
+* With ` + "`--group-by team`" + `, the organization teams are fetched and the highlights and the csv rank teams, by the stats of their members summed. A user in several teams counts towards all of them, and teams include the members of their child teams.
+* The ` + "`--team`" + ` option takes the slug of a team, as in its URL, and restricts the run to its members. Whitelisted users are still included.
+* The ` + "`--repos`" + ` and ` + "`--repos-file`" + ` options scan only the given repositories, which may belong to any owner, instead of the organizations' repositories. Reviews and pull requests are then searched on those repositories only. Without ` + "`--org`" + `, there are no members to filter by, so all contributors are counted, as with ` + "`--all-contributors`" + `.
+* Several organizations can be given to ` + "`--org`" + `, e.g. 'main,infra', in which case their stats are merged per user, and members of any of them are counted. Teams are then given as 'org/slug', and 'repo:foo' in ` + "`--whitelist`" + ` is looked up in every organization.
+* With ` + "`--per-org`" + `, the csv has a row per user and organization, and the json breaks down the stats of each user per organization. Organizations are the owners of the repositories, and reviews and pull requests, which are not tracked per repository, are left out of the breakdown.
+* The ` + "`--identities`" + ` file maps authors to logins, one per line: 'login <email>' claims the commits of an email, even if it isn't linked to any GitHub account, and 'alias -> login' merges the stats of alias into login. Emails are only matched with ` + "`--backend graphql`" + ` and ` + "`--backend git`" + `, since contributor stats don't include them.
+* Options can be kept in a yaml file, 'org-stats.yaml' in the current directory or the one given to ` + "`--config`" + `, whose keys are the names of the flags, e.g. 'org: [main, infra]' or 'include-reviews: true'. Flags given in the command line override it, and a time window given with ` + "`--since`" + `, or with ` + "`--from`" + ` and ` + "`--to`" + `, replaces the one of the file. Its 'aliases' key takes lines in the format of the ` + "`--identities`" + ` file, and the token can only be given through ` + "`--token`" + ` or $GITHUB_TOKEN. Use ` + "`org-stats config validate`" + ` to check it.
 * The ` + "`--token`" + ` token permissions need to include 'repo - Full control of private repositories'. Required only if you need to fetch data from private repositories in your organization.
 }`,
-	PreRun: func(*cobra.Command, []string) {
+	PreRunE: func(cmd *cobra.Command, _ []string) error {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
 		if token == "" {
 			token = os.Getenv("GITHUB_TOKEN")
 		}
+		return loadConfigFile(cmd.Flags(), configPath, cmd.Flags().Changed("config"))
 	},
-	RunE: func(*cobra.Command, []string) error {
+	RunE: func(cmd *cobra.Command, _ []string) error {
 		ctx := context.Background()
-		client, err := newClient(ctx, token, githubURL)
+		if noCache {
+			cacheDir = ""
+		} else if cacheDir == "" {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return fmt.Errorf("failed to find cache directory, use --cache-dir or --no-cache: %w", err)
+			}
+			cacheDir = filepath.Join(dir, "org-stats")
+		}
+
+		client, err := newClient(ctx, token, githubURL, cacheDir)
 		if err != nil {
 			return err
 		}
 
-		sinceD, err := duration.Parse(since)
+		opts, err := buildOptions()
 		if err != nil {
-			return fmt.Errorf("invalid --since duration: '%s'", since)
+			return err
 		}
 
-		userBlacklist, repoBlacklist := buildBlacklists(blacklist)
-		userWhitelist, repoWhitelist := buildWhitelists(whitelist)
-
 		csv := io.Discard
 		if csvPath != "" {
-			if err := os.MkdirAll(filepath.Dir(csvPath), 0o755); err != nil {
-				return fmt.Errorf("failed to create csv file: %w", err)
-			}
-			f, err := os.OpenFile(csvPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			f, err := createFile(csvPath)
 			if err != nil {
 				return fmt.Errorf("failed to create csv file: %w", err)
 			}
@@ -110,32 +196,161 @@ Important notes:
 			csv = f
 		}
 
+		json := io.Discard
+		if jsonPath != "" {
+			f, err := createFile(jsonPath)
+			if err != nil {
+				return fmt.Errorf("failed to create json file: %w", err)
+			}
+			defer f.Close()
+			json = f
+		}
+
+		write := func(stats orgstats.Stats) error {
+			return writeOutputs(csv, json, stats, opts)
+		}
+
+		if noTUI || !isatty.IsTerminal(os.Stdout.Fd()) {
+			// logs are left on stderr, where CI and cron pick them up
+			// on interrupt, stop gathering but still write what was gathered
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			stats, gatherErr := orgstats.Gather(ctx, client, opts)
+			if gatherErr != nil && !errors.Is(gatherErr, context.Canceled) {
+				return gatherErr
+			}
+			if err := write(stats); err != nil {
+				return err
+			}
+			if err := highlights.WritePlain(os.Stdout, stats, top, opts, groupBy == "team"); err != nil {
+				return err
+			}
+			return gatherErr
+		}
+
+		// the UI owns the terminal, so logs go to a file instead
 		f, err := tea.LogToFile(filepath.Join(os.TempDir(), "org-stats.log"), "org-stats")
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		sinceT := time.Time{}
-		if sinceD > 0 {
-			sinceT = time.Now().UTC().Add(-1 * time.Duration(sinceD))
+		p := tea.NewProgram(ui.NewInitialModel(ctx, client, opts, top, groupBy == "team", write))
+		m, err := p.Run()
+		if err != nil {
+			return err
 		}
-
-		p := tea.NewProgram(ui.NewInitialModel(
-			client,
-			organization,
-			userBlacklist,
-			repoBlacklist,
-			userWhitelist,
-			repoWhitelist,
-			sinceT,
-			top,
-			includeReviews,
-			excludeForks,
-			csv,
-			verbose,
-		))
-		_, err = p.Run()
-		return err
+		if m, ok := m.(ui.InitialModel); ok {
+			return m.Err()
+		}
+		return nil
 	},
 }
+
+// buildOptions validates the flags and builds the options to gather stats
+// with from them.
+func buildOptions() (orgstats.Options, error) {
+	sinceD, err := duration.Parse(since)
+	if err != nil {
+		return orgstats.Options{}, fmt.Errorf("invalid --since duration: '%s'", since)
+	}
+
+	fromT, toT, err := buildWindow(sinceD, from, to)
+	if err != nil {
+		return orgstats.Options{}, err
+	}
+
+	if maxRetries < 0 {
+		return orgstats.Options{}, fmt.Errorf("invalid --max-retries: %d", maxRetries)
+	}
+
+	if format != "csv" && format != "timeseries-csv" && format != "json" {
+		return orgstats.Options{}, fmt.Errorf("invalid --format: '%s'", format)
+	}
+
+	switch orgstats.Backend(backend) {
+	case orgstats.BackendREST, orgstats.BackendGraphQL:
+	case orgstats.BackendGit:
+		if cloneDir == "" {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return orgstats.Options{}, fmt.Errorf("failed to find cache directory, use --clone-dir: %w", err)
+			}
+			cloneDir = filepath.Join(dir, "org-stats-repos")
+		}
+	default:
+		return orgstats.Options{}, fmt.Errorf("invalid --backend: '%s'", backend)
+	}
+
+	if groupBy != "user" && groupBy != "team" {
+		return orgstats.Options{}, fmt.Errorf("invalid --group-by: '%s'", groupBy)
+	}
+	if perOrg && groupBy == "team" {
+		return orgstats.Options{}, fmt.Errorf("--per-org can't be used with --group-by team")
+	}
+
+	repoList, err = buildRepos(repoList, reposPath)
+	if err != nil {
+		return orgstats.Options{}, err
+	}
+	if len(organizations) == 0 && len(repoList) == 0 {
+		return orgstats.Options{}, fmt.Errorf("either --org or --repos is required")
+	}
+
+	var botRegexps []*regexp.Regexp
+	for _, pattern := range botPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return orgstats.Options{}, fmt.Errorf("invalid --bot-pattern: '%s': %w", pattern, err)
+		}
+		botRegexps = append(botRegexps, re)
+	}
+
+	userBlacklist, repoBlacklist := buildBlacklists(blacklist)
+	userWhitelist, repoWhitelist := buildWhitelists(whitelist)
+
+	identities, err := buildIdentities(identitiesPath, aliases)
+	if err != nil {
+		return orgstats.Options{}, err
+	}
+
+	opts := orgstats.Options{
+		Orgs:                    organizations,
+		Repos:                   repoList,
+		AllContributors:         allContribs || len(organizations) == 0,
+		IncludeBots:             includeBots,
+		BotPatterns:             botRegexps,
+		UserBlacklist:           userBlacklist,
+		RepoBlacklist:           repoBlacklist,
+		UserWhitelist:           userWhitelist,
+		RepoWhitelist:           repoWhitelist,
+		From:                    fromT,
+		To:                      toT,
+		IncludeReviewStats:      includeReviews,
+		ReviewAllMembers:        reviewMembers,
+		IncludePullRequestStats: includePRs,
+		IncludeIssueStats:       includeIssues,
+		IncludeReviewDepth:      reviewDepth,
+		ExcludeForks:            excludeForks,
+		IncludeTeams:            groupBy == "team",
+		Team:                    team,
+		Concurrency:             concurrency,
+		Verbose:                 verbose,
+		Backend:                 orgstats.Backend(backend),
+		CloneDir:                cloneDir,
+		ExcludePaths:            excludePaths,
+		Token:                   token,
+		Identities:              identities,
+		Retry: orgstats.RetryPolicy{
+			MaxAttempts:    maxRetries + 1, // the first call isn't a retry
+			InitialBackoff: orgstats.DefaultRetryPolicy.InitialBackoff,
+			MaxBackoff:     orgstats.DefaultRetryPolicy.MaxBackoff,
+			Timeout:        requestTimeout,
+		},
+	}
+	if err := orgstats.Validate(opts); err != nil {
+		return orgstats.Options{}, err
+	}
+	return opts, nil
+}
@@ -8,18 +8,20 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-func NewHighlightsModel(stats orgstats.Stats, top int, includeReviews bool) HighlightsModel {
+func NewHighlightsModel(stats orgstats.Stats, top int, opts orgstats.Options, byTeam bool) HighlightsModel {
 	return HighlightsModel{
-		stats:          stats,
-		top:            top,
-		includeReviews: includeReviews,
+		stats:  stats,
+		top:    top,
+		opts:   opts,
+		byTeam: byTeam,
 	}
 }
 
 type HighlightsModel struct {
-	stats          orgstats.Stats
-	top            int
-	includeReviews bool
+	stats  orgstats.Stats
+	top    int
+	opts   orgstats.Options
+	byTeam bool
 }
 
 func (m HighlightsModel) Init() tea.Cmd {
@@ -32,6 +34,6 @@ func (m HighlightsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m HighlightsModel) View() string {
 	var b bytes.Buffer
-	_ = highlights.Write(&b, m.stats, m.top, m.includeReviews)
+	_ = highlights.Write(&b, m.stats, m.top, m.opts, m.byTeam)
 	return b.String()
 }
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/org-stats/orgstats"
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type progressMsg orgstats.Progress
+
+// waitForProgress waits for the next progress event sent by Gather.
+func waitForProgress(events <-chan orgstats.Progress) tea.Cmd {
+	return func() tea.Msg {
+		return progressMsg(<-events)
+	}
+}
+
+// gatherProgress keeps track of the progress events sent by Gather.
+type gatherProgress struct {
+	bar     progress.Model
+	started time.Time
+
+	repos, reposDone int
+	repo             string
+
+	gathering        string // what is being gathered per user, if anything
+	users, usersDone int
+	user             string
+	rateLimitedUntil time.Time
+}
+
+func newGatherProgress() gatherProgress {
+	return gatherProgress{
+		bar: progress.New(progress.WithDefaultGradient(), progress.WithWidth(40)),
+	}
+}
+
+func (p gatherProgress) update(e orgstats.Progress) gatherProgress {
+	switch e.Kind {
+	case orgstats.ProgressRepos:
+		p.repos = e.Total
+		p.started = time.Now()
+	case orgstats.ProgressRepoStarted:
+		p.repo = e.Repo
+	case orgstats.ProgressRepoDone:
+		p.reposDone = e.Done
+	case orgstats.ProgressReviews, orgstats.ProgressPullRequests:
+		gathering := "reviews"
+		if e.Kind == orgstats.ProgressPullRequests {
+			gathering = "pull requests"
+		}
+		if p.gathering != gathering {
+			p.started = time.Now()
+		}
+		p.gathering = gathering
+		p.users = e.Total
+		p.usersDone = e.Done
+		p.user = e.User
+	case orgstats.ProgressRateLimit:
+		if e.Until.After(p.rateLimitedUntil) {
+			p.rateLimitedUntil = e.Until
+		}
+	}
+	return p
+}
+
+func (p gatherProgress) view() string {
+	var done, total int
+	var lines []string
+	switch {
+	case p.gathering != "":
+		done, total = p.usersDone, p.users
+		lines = append(lines, fmt.Sprintf("gathering %s of %s (%d/%d users)", p.gathering, p.user, done, total))
+	case p.repos > 0:
+		done, total = p.reposDone, p.repos
+		lines = append(lines, fmt.Sprintf("scanning %s (%d/%d repositories)", p.repo, done, total))
+	default:
+		return ""
+	}
+
+	percent := float64(done) / float64(total)
+	bar := p.bar.ViewAs(percent)
+	if eta := p.eta(done, total); eta > 0 {
+		bar += fmt.Sprintf("  ETA %s", eta)
+	}
+	lines = append([]string{bar}, lines...)
+
+	if wait := time.Until(p.rateLimitedUntil); wait > 0 {
+		lines = append(lines, fmt.Sprintf("hit rate limit, resuming in %s", wait.Round(time.Second)))
+	}
+	return "   " + strings.Join(lines, "\n   ") + "\n"
+}
+
+// eta estimates how long until all items are done, based on how long the
+// ones done so far took.
+func (p gatherProgress) eta(done, total int) time.Duration {
+	if done == 0 || p.started.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(p.started)
+	return (elapsed / time.Duration(done) * time.Duration(total-done)).Round(time.Second)
+}
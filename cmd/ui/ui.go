@@ -2,12 +2,11 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"time"
+	"strings"
 
-	"github.com/caarlos0/org-stats/csv"
 	"github.com/caarlos0/org-stats/orgstats"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -18,37 +17,43 @@ import (
 type errMsg struct{ error }
 
 // NewInitialModel creates a new InitialModel with required fields.
+// The write function is called with the gathered stats, so they can be saved
+// before the highlights are shown.
 func NewInitialModel(
+	ctx context.Context,
 	client *github.Client,
-	org string,
-	userBlacklist, repoBlacklist []string,
-	userWhitelist, repoWhitelist []string,
-	since time.Time,
+	opts orgstats.Options,
 	top int,
-	includeReviewStats bool,
-	excludeForks bool,
-	csv io.Writer,
-	verbose bool,
+	byTeam bool,
+	write func(orgstats.Stats) error,
 ) InitialModel {
 	s := spinner.New()
 	s.Spinner = spinner.MiniDot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
+	ctx, cancel := context.WithCancel(ctx)
+
+	events := make(chan orgstats.Progress, 100)
+	opts.Progress = func(p orgstats.Progress) {
+		// once the ui quits, nothing reads the events anymore
+		select {
+		case events <- p:
+		case <-ctx.Done():
+		}
+	}
+
 	return InitialModel{
-		client:             client,
-		org:                org,
-		userBlacklist:      userBlacklist,
-		repoBlacklist:      repoBlacklist,
-		userWhitelist:      userWhitelist,
-		repoWhitelist:      repoWhitelist,
-		since:              since,
-		includeReviewStats: includeReviewStats,
-		excludeForks:       excludeForks,
-		top:                top,
-		spinner:            s,
-		csv:                csv,
-		loading:            true,
-		verbose:            verbose,
+		ctx:      ctx,
+		cancel:   cancel,
+		client:   client,
+		opts:     opts,
+		top:      top,
+		byTeam:   byTeam,
+		spinner:  s,
+		progress: newGatherProgress(),
+		events:   events,
+		write:    write,
+		loading:  true,
 	}
 }
 
@@ -56,37 +61,24 @@ func NewInitialModel(
 type InitialModel struct {
 	err      error
 	spinner  spinner.Model
+	progress gatherProgress
+	events   chan orgstats.Progress
 	loading  bool
 	quitting bool
 
-	client             *github.Client
-	org                string
-	userBlacklist      []string
-	repoBlacklist      []string
-	userWhitelist      []string
-	repoWhitelist      []string
-	since              time.Time
-	includeReviewStats bool
-	excludeForks       bool
-	top                int
-	csv                io.Writer
-	verbose            bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *github.Client
+	opts   orgstats.Options
+	top    int
+	byTeam bool
+	write  func(orgstats.Stats) error
 }
 
 func (m InitialModel) Init() tea.Cmd {
 	return tea.Batch(
-		getStats(
-			m.client,
-			m.org,
-			m.userBlacklist,
-			m.repoBlacklist,
-			m.userWhitelist,
-			m.repoWhitelist,
-			m.since,
-			m.includeReviewStats,
-			m.excludeForks,
-			m.verbose,
-		),
+		getStats(m.ctx, m.client, m.opts),
+		waitForProgress(m.events),
 		m.spinner.Tick,
 	)
 }
@@ -96,19 +88,30 @@ func (m InitialModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case errMsg:
 		m.loading = false
 		m.err = msg.error
+		if m.quitting {
+			return m, tea.Quit
+		}
 		return m, nil
+	case progressMsg:
+		m.progress = m.progress.update(orgstats.Progress(msg))
+		return m, waitForProgress(m.events)
 	case gotResults:
 		log.Println("got results", len(msg.stats.Logins()), "logins")
-		highlights := NewHighlightsModel(msg.stats, m.top, m.includeReviewStats)
+		highlights := NewHighlightsModel(msg.stats, m.top, m.opts, m.byTeam)
 		return highlights, tea.Batch(
-			writeCsv(m.csv, msg.stats, m.includeReviewStats),
+			write(m.write, msg.stats),
 			highlights.Init(),
 		)
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q", "esc":
+			if m.quitting || !m.loading {
+				return m, tea.Quit
+			}
+			// stop gathering, the stats gathered so far are still shown
 			m.quitting = true
-			return m, tea.Quit
+			m.cancel()
+			return m, nil
 		}
 	default:
 		var cmd tea.Cmd
@@ -118,45 +121,33 @@ func (m InitialModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// Err returns the error that stopped the gathering of stats, if any.
+func (m InitialModel) Err() error {
+	return m.err
+}
+
 func (m InitialModel) View() string {
 	if m.err != nil {
 		return m.err.Error()
 	}
-	str := fmt.Sprintf("\n\n   %s Gathering data for %s... press q to quit\n\n", m.spinner.View(), m.org)
 	if m.quitting {
-		return str + "\n"
+		return fmt.Sprintf("\n\n   %s Stopping... press q again to quit without results\n\n", m.spinner.View())
 	}
-	return str
+	str := fmt.Sprintf("\n\n   %s Gathering data for %s... press q to quit\n\n", m.spinner.View(), strings.Join(append(m.opts.Orgs, m.opts.Repos...), ", "))
+	return str + m.progress.view()
 }
 
 type gotResults struct {
 	stats orgstats.Stats
 }
 
-func getStats(
-	client *github.Client,
-	org string,
-	userBlacklist, repoBlacklist []string,
-	userWhitelist, repoWhitelist []string,
-	since time.Time,
-	includeReviews bool,
-	excludeForks bool,
-	verbose bool,
-) tea.Cmd {
+func getStats(ctx context.Context, client *github.Client, opts orgstats.Options) tea.Cmd {
 	return func() tea.Msg {
-		stats, err := orgstats.Gather(
-			context.Background(),
-			client,
-			org,
-			userBlacklist,
-			repoBlacklist,
-			userWhitelist,
-			repoWhitelist,
-			since,
-			includeReviews,
-			excludeForks,
-			verbose,
-		)
+		stats, err := orgstats.Gather(ctx, client, opts)
+		if errors.Is(err, context.Canceled) {
+			log.Println("gathering was cancelled, showing partial results")
+			return gotResults{stats}
+		}
 		if err != nil {
 			return errMsg{err}
 		}
@@ -164,9 +155,9 @@ func getStats(
 	}
 }
 
-func writeCsv(w io.Writer, stats orgstats.Stats, includeReviews bool) tea.Cmd {
+func write(fn func(orgstats.Stats) error, stats orgstats.Stats) tea.Cmd {
 	return func() tea.Msg {
-		if err := csv.Write(w, stats, includeReviews); err != nil {
+		if err := fn(stats); err != nil {
 			return errMsg{err}
 		}
 		return tea.Quit
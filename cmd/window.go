@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// buildWindow converts the --since, --from and --to flags into the time
+// window to gather stats from. Zero times leave that side unbounded.
+func buildWindow(since time.Duration, from, to string) (time.Time, time.Time, error) {
+	var fromT, toT time.Time
+	if since > 0 && from != "" {
+		return fromT, toT, fmt.Errorf("--since and --from can't be used together")
+	}
+	if since > 0 {
+		fromT = time.Now().UTC().Add(-1 * since)
+	}
+	if from != "" {
+		t, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return fromT, toT, fmt.Errorf("invalid --from date: '%s'", from)
+		}
+		fromT = t
+	}
+	if to != "" {
+		t, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return fromT, toT, fmt.Errorf("invalid --to date: '%s'", to)
+		}
+		// --to is inclusive, so the window goes until the end of that day
+		toT = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	if !fromT.IsZero() && !toT.IsZero() && toT.Before(fromT) {
+		return fromT, toT, fmt.Errorf("--to can't be before --from")
+	}
+	return fromT, toT, nil
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestBuildWindow(t *testing.T) {
+	is := is.New(t)
+
+	from, to, err := buildWindow(0, "2021-07-01", "2021-09-30")
+	is.NoErr(err)
+	is.Equal(from, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+	is.Equal(to, time.Date(2021, 9, 30, 23, 59, 59, 999999999, time.UTC))
+
+	from, to, err = buildWindow(0, "", "")
+	is.NoErr(err)
+	is.True(from.IsZero())
+	is.True(to.IsZero())
+
+	_, _, err = buildWindow(time.Hour, "2021-07-01", "")
+	is.True(err != nil) // since and from are exclusive
+
+	_, _, err = buildWindow(0, "2021-09-30", "2021-07-01")
+	is.True(err != nil) // to before from
+
+	_, _, err = buildWindow(0, "07/01/2021", "")
+	is.True(err != nil) // bad layout
+}
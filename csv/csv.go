@@ -6,40 +6,254 @@ import (
 	"io"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/caarlos0/org-stats/orgstats"
 )
 
-func Write(w io.Writer, s orgstats.Stats, includeReviews bool) error {
+// Write writes the stats of every login, with the columns of the stats
+// included in the given options. Bots are written in a separate section,
+// after a blank line.
+func Write(w io.Writer, s orgstats.Stats, opts orgstats.Options) error {
 	cw := csv.NewWriter(w)
 	defer cw.Flush()
 
-	headers := []string{"login", "commits", "lines-added", "lines-removed"}
-	if includeReviews {
-		headers = append(headers, "reviews")
+	headers, values := columns(opts)
+	write := func(kind string, logins []string) error {
+		record := append([]string{kind}, headers...)
+		record = append(record, "repos")
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		for _, login := range logins {
+			record := append([]string{login}, values(s.For(login))...)
+			record = append(record, repos(s, login))
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("failed to write csv: %w", err)
+			}
+		}
+		return nil
 	}
-	if err := cw.Write(headers); err != nil {
-		return fmt.Errorf("failed to write csv: %w", err)
+
+	users, bots := splitBots(s)
+	if err := write("login", users); err != nil {
+		return err
+	}
+	if len(bots) > 0 {
+		if err := cw.Write(nil); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		if err := write("bot", bots); err != nil {
+			return err
+		}
 	}
 
+	return cw.Error()
+}
+
+// splitBots returns the sorted logins of users and bots.
+func splitBots(s orgstats.Stats) (users, bots []string) {
 	logins := s.Logins()
 	sort.Strings(logins)
-
 	for _, login := range logins {
-		stat := s.For(login)
-		record := []string{
-			login,
-			strconv.Itoa(stat.Commits),
-			strconv.Itoa(stat.Additions),
-			strconv.Itoa(stat.Deletions),
+		if s.IsBot(login) {
+			bots = append(bots, login)
+		} else {
+			users = append(users, login)
+		}
+	}
+	return users, bots
+}
+
+// WritePerOrg writes the stats of every login on each organization, which
+// are the owners of the repositories. Only stats tracked per repository
+// are written. Bots are written in a separate section, after a blank line.
+func WritePerOrg(w io.Writer, s orgstats.Stats, opts orgstats.Options) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	opts.IncludeReviewStats, opts.IncludePullRequestStats = false, false
+	headers, values := columns(opts)
+	write := func(kind string, logins []string) error {
+		record := append([]string{kind, "org"}, headers...)
+		record = append(record, "repos")
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		for _, login := range logins {
+			for _, org := range s.Orgs() {
+				var orgRepos []string
+				for _, pair := range orgstats.SortRepos(s, login, orgstats.ExtractCommits) {
+					if strings.HasPrefix(pair.Key, org+"/") {
+						orgRepos = append(orgRepos, pair.Key)
+					}
+				}
+				if len(orgRepos) == 0 {
+					continue
+				}
+				record := append([]string{login, org}, values(s.ForOrg(login, org))...)
+				record = append(record, strings.Join(orgRepos, ";"))
+				if err := cw.Write(record); err != nil {
+					return fmt.Errorf("failed to write csv: %w", err)
+				}
+			}
+		}
+		return nil
+	}
+
+	users, bots := splitBots(s)
+	if err := write("login", users); err != nil {
+		return err
+	}
+	if len(bots) > 0 {
+		if err := cw.Write(nil); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
 		}
-		if includeReviews {
-			record = append(record, strconv.Itoa(stat.Reviews))
+		if err := write("bot", bots); err != nil {
+			return err
 		}
+	}
+
+	return cw.Error()
+}
+
+// WriteTeams writes the stats of every team, summed across its members.
+// Bots are left out of the teams, and written with the teams they are in
+// in a separate section, after a blank line.
+func WriteTeams(w io.Writer, s orgstats.Stats, opts orgstats.Options) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	headers, values := columns(opts)
+	if err := cw.Write(append([]string{"team", "members"}, headers...)); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	botTeams := map[string][]string{}
+	for _, team := range s.Teams() {
+		var members []string
+		for _, login := range s.TeamMembers(team) {
+			if s.IsBot(login) {
+				botTeams[login] = append(botTeams[login], team)
+				continue
+			}
+			members = append(members, login)
+		}
+		record := []string{team, strings.Join(members, ";")}
+		record = append(record, values(s.ForTeam(team))...)
 		if err := cw.Write(record); err != nil {
 			return fmt.Errorf("failed to write csv: %w", err)
 		}
 	}
 
+	if len(botTeams) > 0 {
+		if err := cw.Write(nil); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		if err := cw.Write(append([]string{"bot", "teams"}, headers...)); err != nil {
+			return fmt.Errorf("failed to write csv: %w", err)
+		}
+		_, bots := splitBots(s)
+		for _, login := range bots {
+			if len(botTeams[login]) == 0 {
+				continue
+			}
+			record := []string{login, strings.Join(botTeams[login], ";")}
+			record = append(record, values(s.For(login))...)
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("failed to write csv: %w", err)
+			}
+		}
+	}
+
 	return cw.Error()
 }
+
+// columns returns the headers of the stats included in the given options,
+// and a function returning the values of those columns for a stat.
+func columns(opts orgstats.Options) ([]string, func(orgstats.Stat) []string) {
+	headers := []string{"commits", "lines-added", "lines-removed"}
+	extracts := []orgstats.Extract{orgstats.ExtractCommits, orgstats.ExtractAdditions, orgstats.ExtractDeletions}
+	if opts.IncludeReviewStats {
+		headers = append(headers, "reviews")
+		extracts = append(extracts, orgstats.Reviews)
+	}
+	if opts.IncludeReviewDepth {
+		headers = append(headers, "reviews-approved", "reviews-changes-requested", "reviews-commented", "review-comments")
+		extracts = append(
+			extracts,
+			orgstats.ExtractReviewsApproved,
+			orgstats.ExtractReviewsChangesRequested,
+			orgstats.ExtractReviewsCommented,
+			orgstats.ExtractReviewComments,
+		)
+	}
+	if opts.IncludePullRequestStats {
+		headers = append(headers, "prs-opened", "prs-merged", "prs-closed")
+		extracts = append(
+			extracts,
+			orgstats.ExtractPullRequestsOpened,
+			orgstats.ExtractPullRequestsMerged,
+			orgstats.ExtractPullRequestsClosed,
+		)
+	}
+	if opts.IncludeIssueStats {
+		headers = append(headers, "issues-opened", "issues-closed", "issue-comments")
+		extracts = append(
+			extracts,
+			orgstats.ExtractIssuesOpened,
+			orgstats.ExtractIssuesClosed,
+			orgstats.ExtractIssueComments,
+		)
+	}
+	return headers, func(st orgstats.Stat) []string {
+		values := make([]string, 0, len(extracts))
+		for _, extract := range extracts {
+			values = append(values, strconv.Itoa(extract(st)))
+		}
+		return values
+	}
+}
+
+// WriteTimeseries writes the weekly stats of every login on every repository.
+func WriteTimeseries(w io.Writer, s orgstats.Stats) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	headers := []string{"login", "repo", "week", "commits", "additions", "deletions"}
+	if err := cw.Write(headers); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	logins := s.Logins()
+	sort.Strings(logins)
+
+	for _, login := range logins {
+		for _, repo := range s.ReposFor(login) {
+			for _, week := range s.Weeks(login, repo) {
+				record := []string{
+					login,
+					repo,
+					week.Start.Format("2006-01-02"),
+					strconv.Itoa(week.Commits),
+					strconv.Itoa(week.Additions),
+					strconv.Itoa(week.Deletions),
+				}
+				if err := cw.Write(record); err != nil {
+					return fmt.Errorf("failed to write csv: %w", err)
+				}
+			}
+		}
+	}
+
+	return cw.Error()
+}
+
+// repos lists the repositories of the given login, most committed to first.
+func repos(s orgstats.Stats, login string) string {
+	var names []string
+	for _, pair := range orgstats.SortRepos(s, login, orgstats.ExtractCommits) {
+		names = append(names, pair.Key)
+	}
+	return strings.Join(names, ";")
+}
@@ -24,6 +24,10 @@ const (
 
 func IsSecondaryRateLimitError(r *github.Response) (bool, *SecondaryRateLimitError) {
 	var body *SecondaryRateLimitBody
+	if r == nil || r.Response == nil {
+		// the request failed before getting a response
+		return false, nil
+	}
 	res := r.Response
 
 	isRateLimit, b := isSecondaryRateLimit(res)
@@ -3,72 +3,192 @@ package highlights
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"github.com/caarlos0/org-stats/orgstats"
 	"github.com/charmbracelet/lipgloss"
 )
 
-func Write(w io.Writer, s orgstats.Stats, top int, includeReviews bool) error {
+// Write writes the highlights styled for a terminal, ranking teams instead
+// of users if byTeam is set.
+func Write(w io.Writer, s orgstats.Stats, top int, opts orgstats.Options, byTeam bool) error {
+	var headerStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.AdaptiveColor{
+			Dark:  "#BD7EFC",
+			Light: "#7D56F4",
+		}).
+		MarginTop(1).
+		Underline(true)
+
+	var bodyStyle = lipgloss.NewStyle().
+		MarginLeft(2)
+
+	return write(w, s, top, opts, byTeam, headerStyle.Render, bodyStyle.Render)
+}
+
+// WritePlain writes the highlights as plain text, without any styling.
+func WritePlain(w io.Writer, s orgstats.Stats, top int, opts orgstats.Options, byTeam bool) error {
+	header := func(strs ...string) string {
+		return "\n" + strings.Join(strs, " ")
+	}
+	body := func(strs ...string) string {
+		return "  " + strings.Join(strs, " ")
+	}
+	return write(w, s, top, opts, byTeam, header, body)
+}
+
+func write(
+	w io.Writer,
+	s orgstats.Stats,
+	top int,
+	opts orgstats.Options,
+	byTeam bool,
+	header, body func(strs ...string) string,
+) error {
 	data := []statHighlight{
 		{
-			stats:  orgstats.Sort(s, orgstats.ExtractCommits),
-			trophy: "Commits",
-			kind:   "commits",
+			extract: orgstats.ExtractCommits,
+			perRepo: true,
+			trophy:  "Commits",
+			kind:    "commits",
 		}, {
-			stats:  orgstats.Sort(s, orgstats.ExtractAdditions),
-			trophy: "Lines Added",
-			kind:   "lines added",
+			extract: orgstats.ExtractAdditions,
+			perRepo: true,
+			trophy:  "Lines Added",
+			kind:    "lines added",
 		}, {
-			stats:  orgstats.Sort(s, orgstats.ExtractDeletions),
-			trophy: "Housekeeper",
-			kind:   "lines removed",
+			extract: orgstats.ExtractDeletions,
+			perRepo: true,
+			trophy:  "Housekeeper",
+			kind:    "lines removed",
 		},
 	}
 
-	if includeReviews {
+	if opts.IncludeReviewStats {
 		data = append(data, statHighlight{
-			stats:  orgstats.Sort(s, orgstats.Reviews),
-			trophy: "Pull Requests Reviewed",
-			kind:   "pull requests reviewed",
+			extract: orgstats.Reviews,
+			trophy:  "Pull Requests Reviewed",
+			kind:    "pull requests reviewed",
 		})
 	}
 
-	var headerStyle = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(lipgloss.AdaptiveColor{
-			Dark:  "#BD7EFC",
-			Light: "#7D56F4",
-		}).
-		MarginTop(1).
-		Underline(true)
+	if opts.IncludeReviewDepth {
+		data = append(data, statHighlight{
+			extract: orgstats.ExtractReviewComments,
+			perRepo: true,
+			trophy:  "Thorough Reviewer",
+			kind:    "review comments",
+		})
+	}
 
-	var bodyStyle = lipgloss.NewStyle().
-		MarginLeft(2)
+	if opts.IncludePullRequestStats {
+		data = append(data, statHighlight{
+			extract: orgstats.ExtractPullRequestsMerged,
+			trophy:  "Pull Requests Merged",
+			kind:    "pull requests merged",
+		})
+	}
+
+	if opts.IncludeIssueStats {
+		data = append(data, statHighlight{
+			extract: orgstats.ExtractIssuesOpened,
+			perRepo: true,
+			trophy:  "Issues Opened",
+			kind:    "issues opened",
+		}, statHighlight{
+			extract: orgstats.ExtractIssuesClosed,
+			perRepo: true,
+			trophy:  "Triage",
+			kind:    "issues closed",
+		}, statHighlight{
+			extract: orgstats.ExtractIssueComments,
+			perRepo: true,
+			trophy:  "Issue Comments",
+			kind:    "issue comments",
+		})
+	}
 
 	// TODO: handle no results for a given topic
 	for _, d := range data {
 		if _, err := fmt.Fprintln(
 			w,
-			headerStyle.Render(d.trophy+" champions are:"),
+			header(d.trophy+" champions are:"),
 		); err != nil {
 			return err
 		}
+		stats := orgstats.Sort(s, d.extract)
+		if byTeam {
+			stats = orgstats.SortTeams(s, d.extract)
+		}
 		j := top
-		if len(d.stats) < j {
-			j = len(d.stats)
+		if len(stats) < j {
+			j = len(stats)
 		}
 		for i := 0; i < j; i++ {
-			if _, err := fmt.Fprintln(w,
-				bodyStyle.Render(
-					fmt.Sprintf(
-						"%s %s with %d %s!",
-						emojiForPos(i),
-						d.stats[i].Key,
-						d.stats[i].Value,
-						d.kind,
-					),
-				),
-			); err != nil {
+			line := fmt.Sprintf(
+				"%s %s with %d %s",
+				emojiForPos(i),
+				stats[i].Key,
+				stats[i].Value,
+				d.kind,
+			)
+			if byTeam {
+				if member := topMember(s, stats[i].Key, d.extract); member != "" {
+					line += ", mostly by " + member
+				}
+			} else if d.perRepo {
+				if repo := topRepo(s, stats[i].Key, d.extract); repo != "" {
+					line += ", mostly on " + repo
+				}
+			}
+			if _, err := fmt.Fprintln(w, body(line+"!")); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pending := s.Pending(); len(pending) > 0 {
+		if _, err := fmt.Fprintln(w, header("Stats pending:")); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, body(fmt.Sprintf(
+			"GitHub was still computing the stats of %d repositories, which are not included: %s",
+			len(pending),
+			strings.Join(pending, ", "),
+		))); err != nil {
+			return err
+		}
+	}
+
+	if unattributed := s.Unattributed(); len(unattributed) > 0 {
+		emails := make([]string, 0, len(unattributed))
+		for email := range unattributed {
+			emails = append(emails, email)
+		}
+		sort.Slice(emails, func(i, j int) bool {
+			a, b := unattributed[emails[i]], unattributed[emails[j]]
+			if a.Commits != b.Commits {
+				return a.Commits > b.Commits
+			}
+			return emails[i] < emails[j]
+		})
+		if _, err := fmt.Fprintln(w, header("Unattributed commits:")); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, body(fmt.Sprintf(
+			"The commits of %d emails could not be attributed to any login, which are not included, see --identities:",
+			len(emails),
+		))); err != nil {
+			return err
+		}
+		for _, email := range emails[:min(top, len(emails))] {
+			st := unattributed[email]
+			if _, err := fmt.Fprintln(w, body(fmt.Sprintf(
+				"%s with %d commits, %d additions and %d deletions",
+				email, st.Commits, st.Additions, st.Deletions,
+			))); err != nil {
 				return err
 			}
 		}
@@ -76,6 +196,24 @@ func Write(w io.Writer, s orgstats.Stats, top int, includeReviews bool) error {
 	return nil
 }
 
+// topRepo returns the repository the given login contributed the most to.
+func topRepo(s orgstats.Stats, login string, extract orgstats.Extract) string {
+	repos := orgstats.SortRepos(s, login, extract)
+	if len(repos) == 0 || repos[0].Value == 0 {
+		return ""
+	}
+	return repos[0].Key
+}
+
+// topMember returns the member that contributed the most to the given team.
+func topMember(s orgstats.Stats, team string, extract orgstats.Extract) string {
+	members := orgstats.SortTeamMembers(s, team, extract)
+	if len(members) == 0 || members[0].Value == 0 {
+		return ""
+	}
+	return members[0].Key
+}
+
 func emojiForPos(pos int) string {
 	emojis := []string{"\U0001f3c6", "\U0001f948", "\U0001f949"}
 	if pos < len(emojis) {
@@ -85,7 +223,8 @@ func emojiForPos(pos int) string {
 }
 
 type statHighlight struct {
-	stats  []orgstats.StatPair
-	trophy string
-	kind   string
+	extract orgstats.Extract
+	perRepo bool // whether the stat is tracked per repository
+	trophy  string
+	kind    string
 }
@@ -0,0 +1,175 @@
+// Package httpcache implements an on-disk cache of HTTP responses which
+// revalidates them with conditional requests, as recommended by GitHub.
+//
+// Conditional requests answered with a 304 Not Modified don't count
+// against the GitHub API rate limit.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transport is a http.RoundTripper that caches successful GET responses
+// under Dir, and revalidates them using their ETag or Last-Modified headers.
+type Transport struct {
+	Dir  string
+	Base http.RoundTripper
+}
+
+// New returns a new Transport caching responses under dir. If base is nil,
+// http.DefaultTransport is used.
+func New(dir string, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Dir:  dir,
+		Base: base,
+	}
+}
+
+type entry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	path := t.path(req)
+	cached, err := load(path)
+	if err != nil {
+		log.Printf("ignoring cached response for %s: %v", req.URL, err)
+	}
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("Etag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		_ = resp.Body.Close()
+		return cached.response(req, resp.Header), nil
+	}
+
+	if resp.StatusCode != http.StatusOK ||
+		(resp.Header.Get("Etag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := store(path, entry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}); err != nil {
+		log.Printf("failed to cache response for %s: %v", req.URL, err)
+	}
+	return resp, nil
+}
+
+// path returns the file in which responses to the given request are cached.
+// Credentials are part of the key, so different tokens never share entries.
+func (t *Transport) path(req *http.Request) string {
+	h := sha256.New()
+	for _, s := range []string{
+		req.URL.String(),
+		req.Header.Get("Accept"),
+		req.Header.Get("Authorization"),
+	} {
+		_, _ = io.WriteString(h, s+"\n")
+	}
+	return filepath.Join(t.Dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// response rebuilds the cached response, refreshing the rate limit headers
+// from the 304 response.
+func (e *entry) response(req *http.Request, fresh http.Header) *http.Response {
+	header := e.Header.Clone()
+	for k, v := range fresh {
+		if k == "Date" || strings.HasPrefix(strings.ToLower(k), "x-ratelimit-") {
+			header[k] = v
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func load(path string) (*entry, error) {
+	bts, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(bts, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func store(path string, e entry) error {
+	bts, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first so concurrent readers never see
+	// a partially written entry
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bts); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,73 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConditionalRequests tests that cached responses are revalidated with
+// their ETag and served from disk when not modified
+func TestConditionalRequests(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`[{"login":"foo"}]`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(t.TempDir(), nil)}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL + "/orgs/foo/members")
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `[{"login":"foo"}]`, string(body))
+		assert.Equal(t, "42", resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, notModified)
+}
+
+// TestUncacheableResponses tests that responses without validators or with a
+// status other than 200 are not cached
+func TestUncacheableResponses(t *testing.T) {
+	var conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+		}
+		if r.URL.Path == "/accepted" {
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(t.TempDir(), nil)}
+
+	for _, path := range []string{"/accepted", "/accepted", "/no-etag", "/no-etag"} {
+		resp, err := client.Get(server.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, 0, conditional)
+}
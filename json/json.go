@@ -0,0 +1,240 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/caarlos0/org-stats/orgstats"
+)
+
+type report struct {
+	Orgs    []string  `json:"orgs"`
+	From    *string   `json:"from"`
+	To      *string   `json:"to"`
+	Filters filters   `json:"filters"`
+	Users   []userRow `json:"users"`
+	Teams   []teamRow `json:"teams,omitempty"`
+	Pending []string  `json:"stats_pending"`
+
+	Unattributed []emailRow `json:"unattributed"`
+}
+
+type filters struct {
+	UserBlacklist       []string `json:"user_blacklist"`
+	RepoBlacklist       []string `json:"repo_blacklist"`
+	UserWhitelist       []string `json:"user_whitelist"`
+	RepoWhitelist       []string `json:"repo_whitelist"`
+	Repos               []string `json:"repos"`
+	AllContributors     bool     `json:"all_contributors"`
+	ExcludePaths        []string `json:"exclude_paths"`
+	IncludeBots         bool     `json:"include_bots"`
+	IncludeReviews      bool     `json:"include_reviews"`
+	IncludePullRequests bool     `json:"include_pull_requests"`
+	IncludeIssues       bool     `json:"include_issues"`
+	IncludeReviewDepth  bool     `json:"include_review_depth"`
+	ExcludeForks        bool     `json:"exclude_forks"`
+	Team                string   `json:"team,omitempty"`
+}
+
+type userRow struct {
+	Login string `json:"login"`
+	Bot   bool   `json:"bot,omitempty"`
+	stat
+	Orgs  []orgRow  `json:"orgs,omitempty"`
+	Repos []repoRow `json:"repos"`
+}
+
+type orgRow struct {
+	Org string `json:"org"`
+	stat
+}
+
+type teamRow struct {
+	Team    string   `json:"team"`
+	Members []string `json:"members"`
+	stat
+}
+
+type emailRow struct {
+	Email string `json:"email"`
+	stat
+}
+
+type repoRow struct {
+	Repo string `json:"repo"`
+	stat
+}
+
+type stat struct {
+	Commits   int  `json:"commits"`
+	Additions int  `json:"additions"`
+	Deletions int  `json:"deletions"`
+	Reviews   *int `json:"reviews,omitempty"`
+
+	PullRequestsOpened *int `json:"pull_requests_opened,omitempty"`
+	PullRequestsMerged *int `json:"pull_requests_merged,omitempty"`
+	PullRequestsClosed *int `json:"pull_requests_closed,omitempty"`
+
+	IssuesOpened  *int `json:"issues_opened,omitempty"`
+	IssuesClosed  *int `json:"issues_closed,omitempty"`
+	IssueComments *int `json:"issue_comments,omitempty"`
+
+	ReviewsApproved         *int `json:"reviews_approved,omitempty"`
+	ReviewsChangesRequested *int `json:"reviews_changes_requested,omitempty"`
+	ReviewsCommented        *int `json:"reviews_commented,omitempty"`
+	ReviewComments          *int `json:"review_comments,omitempty"`
+}
+
+// newStat returns the given stat, with the counts included in the options.
+func newStat(st orgstats.Stat, opts orgstats.Options) stat {
+	s := stat{
+		Commits:   st.Commits,
+		Additions: st.Additions,
+		Deletions: st.Deletions,
+	}
+	if opts.IncludeReviewStats {
+		reviews := st.Reviews
+		s.Reviews = &reviews
+	}
+	if opts.IncludePullRequestStats {
+		opened, merged, closed := st.PullRequestsOpened, st.PullRequestsMerged, st.PullRequestsClosed
+		s.PullRequestsOpened = &opened
+		s.PullRequestsMerged = &merged
+		s.PullRequestsClosed = &closed
+	}
+	if opts.IncludeIssueStats {
+		s.setIssues(st)
+	}
+	if opts.IncludeReviewDepth {
+		s.setReviewDepth(st)
+	}
+	return s
+}
+
+// newRepoStat returns the given stat with only the counts tracked per
+// repository, of those included in the options.
+func newRepoStat(st orgstats.Stat, opts orgstats.Options) stat {
+	opts.IncludeReviewStats, opts.IncludePullRequestStats = false, false
+	return newStat(st, opts)
+}
+
+// setIssues sets the issue activity counts of the given stat, which are
+// tracked per repository as well.
+func (s *stat) setIssues(st orgstats.Stat) {
+	opened, closed, comments := st.IssuesOpened, st.IssuesClosed, st.IssueComments
+	s.IssuesOpened, s.IssuesClosed, s.IssueComments = &opened, &closed, &comments
+}
+
+// setReviewDepth sets the review breakdown counts of the given stat, which
+// are tracked per repository as well.
+func (s *stat) setReviewDepth(st orgstats.Stat) {
+	approved, changesRequested := st.ReviewsApproved, st.ReviewsChangesRequested
+	commented, comments := st.ReviewsCommented, st.ReviewComments
+	s.ReviewsApproved, s.ReviewsChangesRequested = &approved, &changesRequested
+	s.ReviewsCommented, s.ReviewComments = &commented, &comments
+}
+
+// Write writes the given stats as JSON, along with the options they were
+// gathered with. If perOrg is set, the stats of each user are broken down
+// per organization too, as they are per repository.
+func Write(w io.Writer, s orgstats.Stats, opts orgstats.Options, perOrg bool) error {
+	r := report{
+		Orgs: nonNil(opts.Orgs),
+		From: formatTime(opts.From),
+		To:   formatTime(opts.To),
+		Filters: filters{
+			UserBlacklist:       nonNil(opts.UserBlacklist),
+			RepoBlacklist:       nonNil(opts.RepoBlacklist),
+			UserWhitelist:       nonNil(opts.UserWhitelist),
+			RepoWhitelist:       nonNil(opts.RepoWhitelist),
+			Repos:               nonNil(opts.Repos),
+			AllContributors:     opts.AllContributors,
+			ExcludePaths:        nonNil(opts.ExcludePaths),
+			IncludeBots:         opts.IncludeBots,
+			IncludeReviews:      opts.IncludeReviewStats,
+			IncludePullRequests: opts.IncludePullRequestStats,
+			IncludeIssues:       opts.IncludeIssueStats,
+			IncludeReviewDepth:  opts.IncludeReviewDepth,
+			ExcludeForks:        opts.ExcludeForks,
+			Team:                opts.Team,
+		},
+		Users:   []userRow{},
+		Pending: nonNil(s.Pending()),
+
+		Unattributed: []emailRow{},
+	}
+
+	logins := s.Logins()
+	sort.Strings(logins)
+
+	for _, login := range logins {
+		row := userRow{
+			Login: login,
+			Bot:   s.IsBot(login),
+			stat:  newStat(s.For(login), opts),
+			Repos: []repoRow{},
+		}
+		for _, repo := range s.ReposFor(login) {
+			row.Repos = append(row.Repos, repoRow{
+				Repo: repo,
+				stat: newRepoStat(s.ForRepo(login, repo), opts),
+			})
+		}
+		if perOrg {
+			row.Orgs = []orgRow{}
+			for _, org := range s.Orgs() {
+				if st := s.ForOrg(login, org); st != (orgstats.Stat{}) {
+					row.Orgs = append(row.Orgs, orgRow{Org: org, stat: newRepoStat(st, opts)})
+				}
+			}
+		}
+		r.Users = append(r.Users, row)
+	}
+
+	unattributed := s.Unattributed()
+	emails := make([]string, 0, len(unattributed))
+	for email := range unattributed {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		st := unattributed[email]
+		r.Unattributed = append(r.Unattributed, emailRow{
+			Email: email,
+			stat:  stat{Commits: st.Commits, Additions: st.Additions, Deletions: st.Deletions},
+		})
+	}
+
+	for _, team := range s.Teams() {
+		r.Teams = append(r.Teams, teamRow{
+			Team:    team,
+			Members: nonNil(s.TeamMembers(team)),
+			stat:    newStat(s.ForTeam(team), opts),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to write json: %w", err)
+	}
+	return nil
+}
+
+func formatTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
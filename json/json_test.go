@@ -0,0 +1,121 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/org-stats/orgstats"
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWriteRoundTrip tests that the written report decodes back into the
+// options the stats were gathered with, the stats and the pending repos
+func TestWriteRoundTrip(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"},{"login":"bob"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"app","fork":false},{"name":"computing","fork":false}]`))
+	})
+	mux.HandleFunc("/repos/test-org/app/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]},
+			{"author":{"login":"bob"},"weeks":[{"w":1600000000,"a":5,"d":5,"c":3}]}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/computing/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total_count":2,"items":[]}`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	opts := orgstats.Options{
+		Orgs:               []string{"test-org"},
+		From:               time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:                 time.Date(2020, 9, 30, 23, 59, 59, 0, time.UTC),
+		UserBlacklist:      []string{"/^svc-/"},
+		IncludeReviewStats: true,
+		ExcludeForks:       true,
+		Concurrency:        1,
+		Retry: orgstats.RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		},
+	}
+	stats, err := orgstats.Gather(context.Background(), client, opts)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, stats, opts, false))
+
+	var r report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &r))
+
+	assert.Equal(t, []string{"test-org"}, r.Orgs)
+	assert.Equal(t, "2020-09-01T00:00:00Z", *r.From)
+	assert.Equal(t, "2020-09-30T23:59:59Z", *r.To)
+	assert.Equal(t, filters{
+		UserBlacklist:  []string{"/^svc-/"},
+		RepoBlacklist:  []string{},
+		UserWhitelist:  []string{},
+		RepoWhitelist:  []string{},
+		Repos:          []string{},
+		ExcludePaths:   []string{},
+		IncludeReviews: true,
+		ExcludeForks:   true,
+	}, r.Filters)
+	assert.Equal(t, []string{"test-org/computing"}, r.Pending)
+	assert.Equal(t, []emailRow{}, r.Unattributed)
+
+	reviews := 2
+	assert.Equal(t, []userRow{
+		{
+			Login: "alice",
+			stat:  stat{Commits: 1, Additions: 10, Deletions: 2, Reviews: &reviews},
+			Repos: []repoRow{{Repo: "test-org/app", stat: stat{Commits: 1, Additions: 10, Deletions: 2}}},
+		},
+		{
+			Login: "bob",
+			stat:  stat{Commits: 3, Additions: 5, Deletions: 5, Reviews: &reviews},
+			Repos: []repoRow{{Repo: "test-org/app", stat: stat{Commits: 3, Additions: 5, Deletions: 5}}},
+		},
+	}, r.Users)
+}
+
+// TestWriteUnboundedWindow tests that an unbounded window is written as
+// null bounds, and empty stats as empty lists
+func TestWriteUnboundedWindow(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, orgstats.NewStats(time.Time{}, time.Time{}), orgstats.Options{}, false))
+
+	var raw map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &raw))
+	assert.Nil(t, raw["from"])
+	assert.Nil(t, raw["to"])
+	assert.Equal(t, []any{}, raw["orgs"])
+	assert.Equal(t, []any{}, raw["users"])
+	assert.Equal(t, []any{}, raw["stats_pending"])
+	assert.Equal(t, []any{}, raw["unattributed"])
+}
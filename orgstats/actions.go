@@ -0,0 +1,63 @@
+package orgstats
+
+import "time"
+
+// actionKind is what a login did on an issue or pull request
+type actionKind int
+
+const (
+	issueOpened actionKind = iota
+	issueClosed
+	issueCommented
+	reviewApproved
+	reviewChangesRequested
+	reviewCommented
+	reviewComment
+)
+
+// action is a single action of a login on an issue or pull request of a
+// repository
+type action struct {
+	login    string
+	userType string // User or Bot, if known
+	kind     actionKind
+	when     time.Time
+}
+
+// addAction records a single action on the given repository, matched
+// exactly against the time window.
+func (s *Stats) addAction(repo string, a action) {
+	if !s.from.IsZero() && a.when.Before(s.from) {
+		return
+	}
+	if !s.to.IsZero() && a.when.After(s.to) {
+		return
+	}
+	login := s.identities.Resolve(a.login, "")
+	s.data[login] = s.data[login].withAction(a.kind)
+	if s.repos[login] == nil {
+		s.repos[login] = make(map[string]Stat)
+	}
+	s.repos[login][repo] = s.repos[login][repo].withAction(a.kind)
+}
+
+// withAction returns the stat counting one more action of the given kind.
+func (st Stat) withAction(kind actionKind) Stat {
+	switch kind {
+	case issueOpened:
+		st.IssuesOpened++
+	case issueClosed:
+		st.IssuesClosed++
+	case issueCommented:
+		st.IssueComments++
+	case reviewApproved:
+		st.ReviewsApproved++
+	case reviewChangesRequested:
+		st.ReviewsChangesRequested++
+	case reviewCommented:
+		st.ReviewsCommented++
+	case reviewComment:
+		st.ReviewComments++
+	}
+	return st
+}
@@ -0,0 +1,42 @@
+package orgstats
+
+import (
+	"log"
+	"strings"
+)
+
+// IsBot checks whether the given login was detected as a bot, which only
+// happens when gathering with IncludeBots.
+func (s Stats) IsBot(login string) bool {
+	return s.bots[login]
+}
+
+// isBot checks whether the given login is a bot account: GitHub says so,
+// through userType, its login ends with [bot], as GitHub Apps do, or it
+// matches any of the bot patterns.
+func isBot(opts Options, login, userType string) bool {
+	if userType == "Bot" || strings.HasSuffix(strings.ToLower(login), "[bot]") {
+		return true
+	}
+	for _, re := range opts.BotPatterns {
+		if re.MatchString(login) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowBot checks whether the stats of the given login should be recorded
+// as far as bot detection goes, marking it as a bot if it is one and bots
+// are included.
+func (s *Stats) allowBot(opts Options, login, userType string) bool {
+	if !isBot(opts, login, userType) {
+		return true
+	}
+	if !opts.IncludeBots {
+		log.Println("ignoring bot:", login)
+		return false
+	}
+	s.bots[login] = true
+	return true
+}
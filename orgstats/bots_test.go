@@ -0,0 +1,63 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatherBots(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"carlos"},{"login":"ci-runner"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"carlos","type":"User"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]},
+			{"author":{"login":"ci-runner","type":"User"},"weeks":[{"w":1600000000,"a":50,"d":5,"c":5}]},
+			{"author":{"login":"dependabot[bot]","type":"Bot"},"weeks":[{"w":1600000000,"a":90,"d":9,"c":9}]},
+			{"author":{"login":"some-app","type":"Bot"},"weeks":[{"w":1600000000,"a":20,"d":2,"c":2}]}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	opts := Options{
+		Orgs:            []string{"test-org"},
+		AllContributors: true,
+		BotPatterns:     []*regexp.Regexp{regexp.MustCompile("^ci-")},
+	}
+
+	stats, err := Gather(context.Background(), client, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carlos"}, stats.Logins())
+	assert.False(t, stats.IsBot("carlos"))
+
+	opts.IncludeBots = true
+	stats, err = Gather(context.Background(), client, opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"carlos", "ci-runner", "dependabot[bot]", "some-app"}, stats.Logins())
+	assert.False(t, stats.IsBot("carlos"))
+	assert.True(t, stats.IsBot("ci-runner"))
+	assert.True(t, stats.IsBot("dependabot[bot]"))
+	assert.True(t, stats.IsBot("some-app"))
+	assert.Equal(t, Stat{Additions: 90, Deletions: 9, Commits: 9}, stats.For("dependabot[bot]"))
+}
@@ -0,0 +1,133 @@
+package orgstats
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// repoSelectors match repositories by their metadata instead of their
+// names, e.g. topic:deprecated or archived:true. Their values may be
+// patterns as well.
+var repoSelectors = map[string]func(*github.Repository) []string{
+	"topic": func(repo *github.Repository) []string {
+		return repo.Topics
+	},
+	"lang": func(repo *github.Repository) []string {
+		return []string{repo.GetLanguage()}
+	},
+	"visibility": func(repo *github.Repository) []string {
+		if v := repo.GetVisibility(); v != "" {
+			return []string{v}
+		}
+		if repo.GetPrivate() {
+			return []string{"private"}
+		}
+		return []string{"public"}
+	},
+	"archived": func(repo *github.Repository) []string {
+		return []string{strconv.FormatBool(repo.GetArchived())}
+	},
+}
+
+// IsRepoSelector checks whether the given filter is a selector matching
+// repositories by their metadata, such as topic:deprecated.
+func IsRepoSelector(filter string) bool {
+	name, _, ok := strings.Cut(filter, ":")
+	_, known := repoSelectors[name]
+	return ok && known
+}
+
+// isExactFilter checks whether the given filter is a plain name, as opposed
+// to a pattern or a selector.
+func isExactFilter(filter string) bool {
+	return !IsRepoSelector(filter) && !isRegexpFilter(filter) && !strings.ContainsAny(filter, "*?[")
+}
+
+func isRegexpFilter(filter string) bool {
+	return len(filter) > 1 && strings.HasPrefix(filter, "/") && strings.HasSuffix(filter, "/")
+}
+
+// regexps caches the compiled regular expressions of filters.
+var regexps sync.Map
+
+// matchFilter matches s against a filter, which is either a name, compared
+// ignoring case, a glob pattern such as archive-*, or a regular expression
+// between slashes, such as /^svc-/.
+func matchFilter(filter, s string) bool {
+	if isRegexpFilter(filter) {
+		re, err := compileFilter(filter)
+		return err == nil && re.MatchString(s)
+	}
+	if strings.ContainsAny(filter, "*?[") {
+		ok, _ := path.Match(strings.ToLower(filter), strings.ToLower(s))
+		return ok
+	}
+	return strings.EqualFold(filter, s)
+}
+
+func compileFilter(filter string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(filter); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(filter[1 : len(filter)-1])
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(filter, re)
+	return re, nil
+}
+
+// matchRepo checks whether the given repository matches any of the given
+// filters, by its name, its full name or its metadata.
+func matchRepo(filters []string, repo *github.Repository) bool {
+	for _, filter := range filters {
+		if IsRepoSelector(filter) {
+			name, value, _ := strings.Cut(filter, ":")
+			for _, v := range repoSelectors[name](repo) {
+				if matchFilter(value, v) {
+					return true
+				}
+			}
+			continue
+		}
+		if matchFilter(filter, repo.GetName()) || matchFilter(filter, repo.GetFullName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFilters checks that the patterns of the given options are valid.
+func validateFilters(opts Options) error {
+	for _, list := range [][]string{opts.UserBlacklist, opts.RepoBlacklist, opts.UserWhitelist, opts.RepoWhitelist} {
+		for _, filter := range list {
+			if IsRepoSelector(filter) {
+				selector, value, _ := strings.Cut(filter, ":")
+				if value == "" {
+					return fmt.Errorf("invalid filter %q: %s selector without a value", filter, selector)
+				}
+				filter = value
+			} else if name, _, ok := strings.Cut(filter, ":"); ok && !isRegexpFilter(filter) {
+				// logins and repository names can't have colons, so this
+				// is most likely a misspelled selector
+				return fmt.Errorf("invalid filter %q: unknown selector %q", filter, name)
+			}
+			var err error
+			if isRegexpFilter(filter) {
+				_, err = compileFilter(filter)
+			} else {
+				_, err = path.Match(filter, "")
+			}
+			if err != nil {
+				return fmt.Errorf("invalid filter %q: %w", filter, err)
+			}
+		}
+	}
+	return nil
+}
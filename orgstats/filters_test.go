@@ -0,0 +1,110 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchFilter(t *testing.T) {
+	for _, tt := range []struct {
+		filter, s string
+		match     bool
+	}{
+		{"foo", "FOO", true},
+		{"foo", "foobar", false},
+		{"archive-*", "Archive-2019", true},
+		{"archive-*", "old-archive", false},
+		{"/^svc-/", "svc-deploy", true},
+		{"/^svc-/", "my-svc-deploy", false},
+		{"/[/", "[", false},
+	} {
+		assert.Equal(t, tt.match, matchFilter(tt.filter, tt.s), "%s %s", tt.filter, tt.s)
+	}
+}
+
+func TestMatchRepo(t *testing.T) {
+	repo := &github.Repository{
+		Name:     github.String("legacy-api"),
+		FullName: github.String("test-org/legacy-api"),
+		Topics:   []string{"deprecated", "api"},
+		Language: github.String("Go"),
+		Private:  github.Bool(true),
+		Archived: github.Bool(false),
+	}
+	for filter, match := range map[string]bool{
+		"legacy-api":          true,
+		"test-org/legacy-*":   true,
+		"/api$/":              true,
+		"other":               false,
+		"topic:deprecated":    true,
+		"topic:legacy":        false,
+		"lang:go":             true,
+		"lang:Rust":           false,
+		"visibility:private":  true,
+		"visibility:public":   false,
+		"archived:true":       false,
+		"archived:false":      true,
+		"topic:/^depre/":      true,
+		"something:something": false,
+	} {
+		assert.Equal(t, match, matchRepo([]string{filter}, repo), filter)
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	assert.NoError(t, validateFilters(Options{UserBlacklist: []string{"/^svc-/"}, RepoWhitelist: []string{"topic:*"}}))
+	assert.Error(t, validateFilters(Options{UserBlacklist: []string{"/(/"}}))
+	assert.Error(t, validateFilters(Options{RepoBlacklist: []string{"lang:[go"}}))
+	assert.Error(t, validateFilters(Options{RepoBlacklist: []string{"topic:"}}))
+	assert.Error(t, validateFilters(Options{RepoWhitelist: []string{"lang:"}}))
+	assert.EqualError(t, validateFilters(Options{RepoBlacklist: []string{"topc:deprecated"}}), `invalid filter "topc:deprecated": unknown selector "topc"`)
+	assert.NoError(t, validateFilters(Options{UserBlacklist: []string{"/^(?:svc|ci)-/"}}))
+}
+
+// TestGatherLineStatsRepoPatterns tests that repositories are matched by
+// patterns and selectors, in both whitelist and blacklist
+func TestGatherLineStatsRepoPatterns(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"name":"api","full_name":"test-org/api","language":"Go"},
+			{"name":"old-api","full_name":"test-org/old-api","language":"Go","archived":true},
+			{"name":"web","full_name":"test-org/web","language":"TypeScript"}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"org-member"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]},
+			{"author":{"login":"svc-deploy"},"weeks":[{"w":1600000000,"a":5,"d":5,"c":5}]}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherLineStats(context.Background(), client, Options{
+		Orgs:          []string{"test-org"},
+		RepoWhitelist: []string{"lang:Go"},
+		RepoBlacklist: []string{"archived:true"},
+		UserBlacklist: []string{"/^svc-/"},
+	}, map[string]bool{"org-member": true, "svc-deploy": true}, &stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org-member"}, stats.Logins())
+	assert.Equal(t, []string{"test-org/api"}, stats.Repos())
+}
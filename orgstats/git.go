@@ -0,0 +1,239 @@
+package orgstats
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// commitMarker starts the header line of each commit in the git log output,
+// as printed by %x1e, which is followed by the numstat lines of the commit.
+const commitMarker = "\x1e"
+
+// getGitCommits mirror-clones the given repository into opts.CloneDir, or
+// updates the existing mirror, and returns the commits of its default
+// branch, skipping merge commits as GitHub's contributor stats do. Commits
+// are dated by when they were authored, as with BackendGraphQL. Lines of
+// files matching opts.ExcludePaths are not counted.
+func getGitCommits(ctx context.Context, opts Options, cloneURL, owner, name string) ([]commit, error) {
+	dir := filepath.Join(opts.CloneDir, owner, name+".git")
+	if err := mirror(ctx, opts, cloneURL, dir); err != nil {
+		return nil, fmt.Errorf("failed to mirror %s/%s: %w", owner, name, err)
+	}
+
+	out, err := git(ctx, opts, dir, "log", "--no-merges", "--numstat", "--format=%x1e%at%x00%ae%x00%H")
+	if err != nil {
+		if isEmptyRepo(ctx, opts, dir) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read history of %s/%s: %w", owner, name, err)
+	}
+	commits, err := parseGitLog(out, opts.ExcludePaths)
+	if err != nil {
+		return commits, fmt.Errorf("failed to read history of %s/%s: %w", owner, name, err)
+	}
+	return commits, nil
+}
+
+// mirror clones the given repository as a bare mirror into dir, or fetches
+// its updates if it was already cloned.
+func mirror(ctx context.Context, opts Options, cloneURL, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		if opts.Verbose {
+			log.Printf("Fetching updates of %s", dir)
+		}
+		_, err := git(ctx, opts, dir, "fetch", "--prune", "--quiet", "origin")
+		return err
+	}
+
+	if opts.Verbose {
+		log.Printf("Cloning %s into %s", cloneURL, dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	// a partial clone would be mistaken for a complete one next time
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := git(ctx, opts, "", "clone", "--mirror", "--quiet", cloneURL, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// isEmptyRepo checks whether the repository in dir has no commits.
+func isEmptyRepo(ctx context.Context, opts Options, dir string) bool {
+	_, err := git(ctx, opts, dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	return err != nil
+}
+
+// git runs the given git command on the repository in dir, if any, and
+// returns its output. Requests are authenticated with opts.Token if set.
+func git(ctx context.Context, opts Options, dir string, args ...string) ([]byte, error) {
+	// paths are printed as is, so they can be matched against patterns
+	global := []string{"-c", "core.quotePath=false"}
+	if dir != "" {
+		global = append(global, "--git-dir", dir)
+	}
+	cmd := exec.CommandContext(ctx, "git", append(global, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if opts.Token != "" {
+		// passed through the environment, as the command line can be read
+		// by any local user
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + opts.Token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// parseGitLog parses the output of git log with commitMarker headers and
+// numstat lines, leaving out the lines of files matching the exclude
+// patterns. Binary files count no lines, as on GitHub.
+func parseGitLog(out []byte, exclude []string) ([]commit, error) {
+	var commits []commit
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if header, ok := strings.CutPrefix(line, commitMarker); ok {
+			ts, rest, _ := strings.Cut(header, "\x00")
+			email, sha, _ := strings.Cut(rest, "\x00")
+			sec, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return commits, fmt.Errorf("invalid commit header %q: %w", line, err)
+			}
+			commits = append(commits, commit{
+				login: noreplyLogin(email),
+				email: email,
+				when:  time.Unix(sec, 0).UTC(),
+				sha:   sha,
+			})
+			continue
+		}
+		if line == "" || len(commits) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return commits, fmt.Errorf("invalid numstat line %q", line)
+		}
+		if isExcludedPath(exclude, renamedPath(fields[2])) {
+			continue
+		}
+		c := &commits[len(commits)-1]
+		adds, _ := strconv.Atoi(fields[0]) // "-" for binary files
+		rms, _ := strconv.Atoi(fields[1])
+		c.additions += adds
+		c.deletions += rms
+	}
+	return commits, scanner.Err()
+}
+
+// noreplyLogin returns the login of a GitHub noreply email, such as
+// 123+login@users.noreply.github.com, or an empty string otherwise.
+// Other emails are attributed through the identity map, or else by
+// attributeCommits.
+func noreplyLogin(email string) string {
+	const domain = "@users.noreply.github.com"
+	if len(email) <= len(domain) || !strings.EqualFold(email[len(email)-len(domain):], domain) {
+		return ""
+	}
+	local := email[:len(email)-len(domain)]
+	if _, login, ok := strings.Cut(local, "+"); ok {
+		return login
+	}
+	return local
+}
+
+// emailLogins caches the logins GitHub links author emails to, so each email
+// is only looked up once per run.
+type emailLogins struct {
+	mu     sync.Mutex
+	logins map[string]string // email -> login, empty if not linked
+}
+
+// attributeCommits sets the login of the commits of the given repository
+// whose author email is neither a noreply email nor in the identity map, to
+// the account GitHub links to one commit of that email. Commits of emails
+// not linked to any account are left without a login.
+func attributeCommits(
+	ctx context.Context,
+	client *github.Client,
+	opts Options,
+	owner, name string,
+	commits []commit,
+	cache *emailLogins,
+) error {
+	for i, c := range commits {
+		if c.login != "" || opts.Identities.Resolve("", c.email) != "" {
+			continue
+		}
+		login, err := cache.lookup(ctx, client, opts.Retry, owner, name, c)
+		if err != nil {
+			return err
+		}
+		commits[i].login = login
+	}
+	return nil
+}
+
+// lookup returns the login of the author of the given commit, or of an
+// earlier looked up commit with the same email.
+func (e *emailLogins) lookup(ctx context.Context, client *github.Client, retry RetryPolicy, owner, name string, c commit) (string, error) {
+	key := strings.ToLower(c.email)
+	e.mu.Lock()
+	login, ok := e.logins[key]
+	e.mu.Unlock()
+	if ok {
+		return login, nil
+	}
+
+	var rc *github.RepositoryCommit
+	err := retry.do(ctx, "get commit "+owner+"/"+name+"@"+c.sha, func(ctx context.Context) (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		rc, resp, err = client.Repositories.GetCommit(ctx, owner, name, c.sha, &github.ListOptions{PerPage: 1})
+		return resp, err
+	})
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && (errResp.Response.StatusCode == http.StatusNotFound || errResp.Response.StatusCode == http.StatusUnprocessableEntity) {
+		// the commit was never pushed to GitHub, so it can't tell
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get author of %s/%s@%s: %w", owner, name, c.sha, err)
+	}
+	login = rc.GetAuthor().GetLogin()
+
+	e.mu.Lock()
+	e.logins[key] = login
+	e.mu.Unlock()
+	return login, nil
+}
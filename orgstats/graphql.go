@@ -0,0 +1,300 @@
+package orgstats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphql runs the given GraphQL query, decoding the data of the response
+// into v. Errors about missing nodes (e.g. users that no longer exist) are
+// ignored, their nodes are left null in the data.
+func graphql(
+	ctx context.Context,
+	client *github.Client,
+	retry RetryPolicy,
+	query string,
+	variables map[string]interface{},
+	v interface{},
+) error {
+	var resp graphqlResponse
+	if err := retry.do(ctx, "graphql query", func(ctx context.Context) (*github.Response, error) {
+		req, err := client.NewRequest(http.MethodPost, graphqlURL(client.BaseURL), map[string]interface{}{
+			"query":     query,
+			"variables": variables,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp = graphqlResponse{}
+		return client.Do(ctx, req, &resp)
+	}); err != nil {
+		return fmt.Errorf("failed to run graphql query: %w", err)
+	}
+	for _, err := range resp.Errors {
+		if err.Type != "NOT_FOUND" {
+			return fmt.Errorf("failed to run graphql query: %s", err.Message)
+		}
+		log.Println("ignoring graphql error:", err.Message)
+	}
+	return json.Unmarshal(resp.Data, v)
+}
+
+// graphqlURL returns the GraphQL endpoint of the API at the given REST base
+// URL, which is /api/graphql on GitHub Enterprise.
+func graphqlURL(base *url.URL) string {
+	u := *base
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path += "graphql"
+	}
+	return u.String()
+}
+
+// commit is a single commit from a repository's history
+type commit struct {
+	login, email         string
+	when                 time.Time
+	additions, deletions int
+	sha                  string // only set by BackendGit
+}
+
+const commitsQuery = `query($owner: String!, $name: String!, $since: GitTimestamp, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    defaultBranchRef {
+      target {
+        ... on Commit {
+          history(first: 100, after: $cursor, since: $since) {
+            pageInfo { hasNextPage endCursor }
+            nodes {
+              authoredDate
+              additions
+              deletions
+              parents { totalCount }
+              author { email user { login } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// getCommits returns the commits of the default branch of the given
+// repository, skipping merge commits as GitHub's contributor stats do.
+//
+// Commits are dated by when they were authored, as rebased and squashed
+// commits are committed when merged. The history can only be filtered by
+// commit date, so it is only bounded by the start of the window and commits
+// authored after its end are left out by addCommit.
+//
+// Each call returns up to 100 commits, so a repository costs one call per
+// 100 commits since the start of the window, as opposed to a single call
+// for its contributor stats with BackendREST.
+func getCommits(ctx context.Context, client *github.Client, opts Options, owner, name string) ([]commit, error) {
+	variables := map[string]interface{}{
+		"owner": owner,
+		"name":  name,
+	}
+	if !opts.From.IsZero() {
+		variables["since"] = opts.From.UTC().Format(time.RFC3339)
+	}
+
+	var commits []commit
+	for {
+		var data struct {
+			Repository struct {
+				DefaultBranchRef *struct {
+					Target struct {
+						History struct {
+							PageInfo struct {
+								HasNextPage bool
+								EndCursor   string
+							}
+							Nodes []struct {
+								AuthoredDate time.Time
+								Additions    int
+								Deletions    int
+								Parents      struct{ TotalCount int }
+								Author       struct {
+									Email string
+									User  *struct{ Login string }
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		if err := graphql(ctx, client, opts.Retry, commitsQuery, variables, &data); err != nil {
+			return commits, fmt.Errorf("failed to get commits of %s/%s: %w", owner, name, err)
+		}
+
+		ref := data.Repository.DefaultBranchRef
+		if ref == nil {
+			// empty repository
+			return commits, nil
+		}
+		for _, node := range ref.Target.History.Nodes {
+			if node.Parents.TotalCount > 1 {
+				continue
+			}
+			c := commit{
+				email:     node.Author.Email,
+				when:      node.AuthoredDate,
+				additions: node.Additions,
+				deletions: node.Deletions,
+			}
+			if node.Author.User != nil {
+				c.login = node.Author.User.Login
+			}
+			commits = append(commits, c)
+		}
+
+		page := ref.Target.History.PageInfo
+		if !page.HasNextPage {
+			return commits, nil
+		}
+		variables["cursor"] = page.EndCursor
+	}
+}
+
+// reviewsBatchSize is how many users have their reviews counted per query.
+const reviewsBatchSize = 25
+
+// gatherGraphQLReviewStats counts the pull request reviews of the given
+// users on the repositories of each organization, using their contributions
+// collections, which are limited to a year each.
+func gatherGraphQLReviewStats(
+	ctx context.Context,
+	client *github.Client,
+	opts Options,
+	users []string,
+	allStats *Stats,
+) error {
+	for n, orgLogin := range opts.Orgs {
+		if err := gatherOrgGraphQLReviewStats(ctx, client, opts, orgLogin, users, n*len(users), allStats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gatherOrgGraphQLReviewStats counts the reviews of the given users on the
+// repositories of a single organization, reporting progress from done on.
+func gatherOrgGraphQLReviewStats(
+	ctx context.Context,
+	client *github.Client,
+	opts Options,
+	orgLogin string,
+	users []string,
+	done int,
+	allStats *Stats,
+) error {
+	var org struct {
+		Organization struct {
+			ID        string
+			CreatedAt time.Time
+		}
+	}
+	if err := graphql(ctx, client, opts.Retry, `query($org: String!) {
+  organization(login: $org) { id createdAt }
+}`, map[string]interface{}{"org": orgLogin}, &org); err != nil {
+		return fmt.Errorf("failed to get organization %s: %w", orgLogin, err)
+	}
+
+	from, to := opts.From, opts.To
+	if from.IsZero() {
+		from = org.Organization.CreatedAt
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+
+	for i := 0; i < len(users); i += reviewsBatchSize {
+		batch := users[i:min(i+reviewsBatchSize, len(users))]
+		report(ctx, Progress{Kind: ProgressReviews, Done: done + i, Total: len(users) * len(opts.Orgs), User: batch[0]})
+
+		for start := from; start.Before(to); start = start.AddDate(1, 0, 0) {
+			end := start.AddDate(1, 0, 0).Add(-time.Second)
+			if end.After(to) {
+				end = to
+			}
+			reviews, err := countReviewContributions(ctx, client, opts.Retry, org.Organization.ID, batch, start, end)
+			if err != nil {
+				return err
+			}
+			for user, reviewed := range reviews {
+				if opts.Verbose {
+					log.Printf("Found %d reviews for user %s between %s and %s", reviewed, user, start, end)
+				}
+				allStats.addReviewStats(user, reviewed)
+			}
+		}
+	}
+	return nil
+}
+
+// countReviewContributions counts the reviews of the given users within a
+// window of at most a year, using a single query.
+func countReviewContributions(
+	ctx context.Context,
+	client *github.Client,
+	retry RetryPolicy,
+	orgID string,
+	users []string,
+	from, to time.Time,
+) (map[string]int, error) {
+	variables := map[string]interface{}{
+		"org":  orgID,
+		"from": from.UTC().Format(time.RFC3339),
+		"to":   to.UTC().Format(time.RFC3339),
+	}
+	var params, fields []string
+	for i, user := range users {
+		variables[fmt.Sprintf("l%d", i)] = user
+		params = append(params, fmt.Sprintf("$l%d: String!", i))
+		fields = append(fields, fmt.Sprintf(
+			"u%d: user(login: $l%d) { contributionsCollection(organizationID: $org, from: $from, to: $to) { totalPullRequestReviewContributions } }",
+			i, i,
+		))
+	}
+	query := fmt.Sprintf(
+		"query($org: ID!, $from: DateTime!, $to: DateTime!, %s) {\n  %s\n}",
+		strings.Join(params, ", "),
+		strings.Join(fields, "\n  "),
+	)
+
+	var data map[string]*struct {
+		ContributionsCollection struct {
+			TotalPullRequestReviewContributions int
+		}
+	}
+	if err := graphql(ctx, client, retry, query, variables, &data); err != nil {
+		return nil, fmt.Errorf("failed to count reviews: %w", err)
+	}
+
+	reviews := map[string]int{}
+	for i, user := range users {
+		if node := data[fmt.Sprintf("u%d", i)]; node != nil {
+			reviews[user] = node.ContributionsCollection.TotalPullRequestReviewContributions
+		}
+	}
+	return reviews, nil
+}
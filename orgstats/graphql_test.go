@@ -0,0 +1,90 @@
+package orgstats
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGatherGraphQL tests that the graphql backend counts commits with exact
+// time boundaries, and reviews from contributions collections
+func TestGatherGraphQL(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"org-member","id":1}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(string(body), "history"):
+			assert.Contains(t, string(body), `"since":"2021-07-01T00:00:00Z"`)
+			assert.NotContains(t, string(body), `"until"`)
+			w.Write([]byte(`{"data":{"repository":{"defaultBranchRef":{"target":{"history":{
+				"pageInfo":{"hasNextPage":false},
+				"nodes":[
+					{"authoredDate":"2021-07-01T10:00:00Z","additions":10,"deletions":1,"parents":{"totalCount":1},"author":{"email":"a@b.c","user":{"login":"org-member"}}},
+					{"authoredDate":"2021-07-02T10:00:00Z","additions":5,"deletions":5,"parents":{"totalCount":2},"author":{"email":"a@b.c","user":{"login":"org-member"}}},
+					{"authoredDate":"2021-07-02T10:00:00Z","additions":5,"deletions":5,"parents":{"totalCount":1},"author":{"email":"x@y.z","user":null}},
+					{"authoredDate":"2021-07-02T10:00:00Z","additions":5,"deletions":5,"parents":{"totalCount":1},"author":{"email":"x@y.z","user":{"login":"outsider"}}},
+					{"authoredDate":"2021-10-02T10:00:00Z","additions":5,"deletions":5,"parents":{"totalCount":1},"author":{"email":"a@b.c","user":{"login":"org-member"}}}
+				]
+			}}}}}}`))
+		case strings.Contains(string(body), "createdAt"):
+			w.Write([]byte(`{"data":{"organization":{"id":"O_1","createdAt":"2010-01-01T00:00:00Z"}}}`))
+		case strings.Contains(string(body), "contributionsCollection"):
+			w.Write([]byte(`{"data":{"u0":{"contributionsCollection":{"totalPullRequestReviewContributions":7}}}}`))
+		default:
+			t.Errorf("unexpected query: %s", body)
+		}
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:               []string{"test-org"},
+		From:               time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		To:                 time.Date(2021, 9, 30, 0, 0, 0, 0, time.UTC),
+		IncludeReviewStats: true,
+		Backend:            BackendGraphQL,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org-member"}, stats.Logins())
+	assert.Equal(t, Stat{Additions: 10, Deletions: 1, Commits: 1, Reviews: 7}, stats.For("org-member"))
+	assert.Equal(t, []Week{{
+		Start:     time.Date(2021, 6, 27, 0, 0, 0, 0, time.UTC),
+		Additions: 10,
+		Deletions: 1,
+		Commits:   1,
+	}}, stats.Weeks("org-member", "test-org/repo"))
+}
+
+func TestGraphqlURL(t *testing.T) {
+	for base, expected := range map[string]string{
+		"https://api.github.com/":            "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/graphql",
+	} {
+		u, _ := url.Parse(base)
+		assert.Equal(t, expected, graphqlURL(u))
+	}
+}
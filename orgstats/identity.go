@@ -0,0 +1,101 @@
+package orgstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// IdentityMap maps git author emails and GitHub logins to the canonical
+// login their stats are recorded under. The zero value maps nothing.
+type IdentityMap struct {
+	emails map[string]string // email -> login
+	logins map[string]string // alias login -> canonical login
+}
+
+// ParseIdentities reads an identity map in a mailmap-like format, one
+// mapping per line:
+//
+//	login <email>                     commits by email belong to login
+//	login <proper-email> <email>      same, for both emails
+//	alias -> login                    stats of alias belong to login
+//
+// Blank lines and lines starting with # are ignored.
+func ParseIdentities(r io.Reader) (IdentityMap, error) {
+	m := IdentityMap{
+		emails: map[string]string{},
+		logins: map[string]string{},
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if alias, login, ok := strings.Cut(line, "->"); ok {
+			alias, login = strings.TrimSpace(alias), strings.TrimSpace(login)
+			if alias == "" || login == "" || strings.ContainsAny(alias+login, " <>") {
+				return m, fmt.Errorf("invalid alias on line %d: %q", n, line)
+			}
+			m.logins[strings.ToLower(alias)] = login
+			continue
+		}
+
+		login, rest, ok := strings.Cut(line, "<")
+		login = strings.TrimSpace(login)
+		if !ok || login == "" || strings.Contains(login, " ") {
+			return m, fmt.Errorf("invalid mapping on line %d: %q", n, line)
+		}
+		for rest = "<" + rest; rest != ""; rest = strings.TrimSpace(rest) {
+			email, after, ok := strings.Cut(strings.TrimPrefix(rest, "<"), ">")
+			if !strings.HasPrefix(rest, "<") || !ok || email == "" {
+				return m, fmt.Errorf("invalid email on line %d: %q", n, line)
+			}
+			m.emails[strings.ToLower(email)] = login
+			rest = after
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, fmt.Errorf("failed to read identities: %w", err)
+	}
+	return m, nil
+}
+
+// Resolve returns the canonical login of the given author, which is looked
+// up by email first, so commits of unlinked emails can be claimed. It
+// returns an empty string if the author can't be identified.
+func (m IdentityMap) Resolve(login, email string) string {
+	if mapped, ok := m.emails[strings.ToLower(email)]; ok && email != "" {
+		login = mapped
+	}
+	// follow chained aliases, bounded in case they form a cycle
+	for i := 0; i < len(m.logins); i++ {
+		canonical, ok := m.logins[strings.ToLower(login)]
+		if !ok {
+			break
+		}
+		login = canonical
+	}
+	return login
+}
+
+// withAliases returns the given logins followed by the aliases resolving to
+// any of them, so the activity of the aliases can be searched as well.
+func (m IdentityMap) withAliases(logins []string) []string {
+	seen := map[string]bool{}
+	for _, login := range logins {
+		seen[strings.ToLower(login)] = true
+	}
+	var aliases []string
+	for alias := range m.logins {
+		if seen[alias] || !seen[strings.ToLower(m.Resolve(alias, ""))] {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return append(append([]string(nil), logins...), aliases...)
+}
@@ -0,0 +1,164 @@
+package orgstats
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIdentities(t *testing.T) {
+	m, err := ParseIdentities(strings.NewReader(`
+# people
+carlos <carlos@work.com> <Carlos@Home.com>
+carlos <old@laptop>
+carlos-personal -> carlos
+bot-old -> bot-new
+bot-new -> bot
+`))
+	assert.NoError(t, err)
+
+	for _, tt := range []struct{ login, email, expected string }{
+		{"", "carlos@home.com", "carlos"},
+		{"", "old@laptop", "carlos"},
+		{"", "carlos@work.com", "carlos"},
+		{"someone", "carlos@work.com", "carlos"},
+		{"Carlos-Personal", "", "carlos"},
+		{"bot-old", "", "bot"},
+		{"someone", "someone@else.com", "someone"},
+		{"", "unknown@else.com", ""},
+	} {
+		assert.Equal(t, tt.expected, m.Resolve(tt.login, tt.email), "%s <%s>", tt.login, tt.email)
+	}
+
+	for _, invalid := range []string{
+		"carlos",
+		"carlos <carlos@work.com",
+		"carlos <>",
+		"carlos work <carlos@work.com>",
+		"carlos <a@b.c> d@e.f",
+		"-> carlos",
+		"carlos personal -> carlos",
+	} {
+		_, err := ParseIdentities(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestGatherIdentities tests that stats of alias accounts are merged into
+// the canonical login, and that unlinked commits are claimed by email
+func TestGatherIdentities(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"carlos"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"repository":{"defaultBranchRef":{"target":{"history":{
+			"pageInfo":{"hasNextPage":false},
+			"nodes":[
+				{"authoredDate":"2021-07-01T10:00:00Z","additions":1,"deletions":1,"parents":{"totalCount":1},"author":{"email":"carlos@work.com","user":{"login":"carlos"}}},
+				{"authoredDate":"2021-07-01T10:00:00Z","additions":2,"deletions":2,"parents":{"totalCount":1},"author":{"email":"old@laptop","user":null}},
+				{"authoredDate":"2021-07-01T10:00:00Z","additions":4,"deletions":4,"parents":{"totalCount":1},"author":{"email":"me@home.com","user":{"login":"carlos-personal"}}},
+				{"authoredDate":"2021-07-01T10:00:00Z","additions":8,"deletions":8,"parents":{"totalCount":1},"author":{"email":"unknown@else.com","user":null}}
+			]
+		}}}}}}`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	identities, err := ParseIdentities(strings.NewReader("carlos <old@laptop>\ncarlos-personal -> carlos\n"))
+	assert.NoError(t, err)
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:       []string{"test-org"},
+		Backend:    BackendGraphQL,
+		Identities: identities,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carlos"}, stats.Logins())
+	assert.Equal(t, Stat{Additions: 7, Deletions: 7, Commits: 3}, stats.For("carlos"))
+}
+
+// TestGatherAliasReviews tests that the reviews and pull requests of alias
+// logins are searched and added to their canonical logins
+func TestGatherAliasReviews(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"carlos"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"carlos"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+	counts := map[string]int{
+		"user:test-org is:pr reviewed-by:carlos":                           2,
+		"user:test-org is:pr reviewed-by:carlos-personal":                  3,
+		"user:test-org is:pr author:carlos":                                1,
+		"user:test-org is:pr author:carlos is:merged":                      1,
+		"user:test-org is:pr author:carlos is:closed is:unmerged":          0,
+		"user:test-org is:pr author:carlos-personal":                       4,
+		"user:test-org is:pr author:carlos-personal is:merged":             2,
+		"user:test-org is:pr author:carlos-personal is:closed is:unmerged": 1,
+	}
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		count, ok := counts[q]
+		assert.True(t, ok, "unexpected query: %s", q)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"total_count":%d,"items":[]}`, count)
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	identities, err := ParseIdentities(strings.NewReader("carlos-personal -> carlos\nsomeone-else -> nobody\n"))
+	assert.NoError(t, err)
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:                    []string{"test-org"},
+		Identities:              identities,
+		IncludeReviewStats:      true,
+		IncludePullRequestStats: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carlos"}, stats.Logins())
+	assert.Equal(t, Stat{
+		Additions:          10,
+		Deletions:          2,
+		Commits:            1,
+		Reviews:            5,
+		PullRequestsOpened: 5,
+		PullRequestsMerged: 3,
+		PullRequestsClosed: 1,
+	}, stats.For("carlos"))
+}
@@ -0,0 +1,119 @@
+package orgstats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// getIssueActions returns who opened, closed and commented on the issues of
+// the given repository since the given time. Pull requests are skipped.
+func getIssueActions(ctx context.Context, client *github.Client, retry RetryPolicy, owner, name string, since time.Time) ([]action, error) {
+	var actions []action
+
+	// issues updated since the given time, which includes all the ones
+	// created after it
+	issueOpts := &github.IssueListByRepoOptions{
+		State:       "all",
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		var issues []*github.Issue
+		var resp *github.Response
+		if err := retry.do(ctx, "list issues of "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			issues, resp, err = client.Issues.ListByRepo(ctx, owner, name, issueOpts)
+			return resp, err
+		}); err != nil {
+			return actions, fmt.Errorf("failed to list issues of %s/%s: %w", owner, name, err)
+		}
+		for _, issue := range issues {
+			if issue.IsPullRequest() {
+				continue
+			}
+			actions = append(actions, action{
+				login:    issue.GetUser().GetLogin(),
+				userType: issue.GetUser().GetType(),
+				kind:     issueOpened,
+				when:     issue.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		issueOpts.Page = resp.NextPage
+	}
+
+	// events come newest first, so stop once they are older than since
+	eventOpts := &github.ListOptions{PerPage: 100}
+events:
+	for {
+		var events []*github.IssueEvent
+		var resp *github.Response
+		if err := retry.do(ctx, "list issue events of "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			events, resp, err = client.Issues.ListRepositoryEvents(ctx, owner, name, eventOpts)
+			return resp, err
+		}); err != nil {
+			return actions, fmt.Errorf("failed to list issue events of %s/%s: %w", owner, name, err)
+		}
+		for _, event := range events {
+			if event.GetCreatedAt().Before(since) {
+				break events
+			}
+			if event.GetEvent() != "closed" || event.GetIssue().IsPullRequest() {
+				continue
+			}
+			actions = append(actions, action{
+				login:    event.GetActor().GetLogin(),
+				userType: event.GetActor().GetType(),
+				kind:     issueClosed,
+				when:     event.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		eventOpts.Page = resp.NextPage
+	}
+
+	// comments of all issues and pull requests, updated since the given time
+	commentOpts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	if !since.IsZero() {
+		commentOpts.Since = &since
+	}
+	for {
+		var comments []*github.IssueComment
+		var resp *github.Response
+		if err := retry.do(ctx, "list issue comments of "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			comments, resp, err = client.Issues.ListComments(ctx, owner, name, 0, commentOpts)
+			return resp, err
+		}); err != nil {
+			return actions, fmt.Errorf("failed to list issue comments of %s/%s: %w", owner, name, err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetHTMLURL(), "/pull/") {
+				continue
+			}
+			actions = append(actions, action{
+				login:    comment.GetUser().GetLogin(),
+				userType: comment.GetUser().GetType(),
+				kind:     issueCommented,
+				when:     comment.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.Page = resp.NextPage
+	}
+
+	return actions, nil
+}
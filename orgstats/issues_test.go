@@ -0,0 +1,79 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGatherIssueStats tests that issue activity is counted for members
+// without commits, leaving pull requests and old activity out
+func TestGatherIssueStats(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"triager","id":1}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+		assert.Equal(t, "2021-07-01T00:00:00Z", r.URL.Query().Get("since"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"number":1,"created_at":"2021-07-02T00:00:00Z","user":{"login":"triager"}},
+			{"number":2,"created_at":"2021-06-02T00:00:00Z","user":{"login":"triager"}},
+			{"number":3,"created_at":"2021-07-02T00:00:00Z","user":{"login":"triager"},"pull_request":{"url":"x"}},
+			{"number":4,"created_at":"2021-07-02T00:00:00Z","user":{"login":"outsider"}}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/issues/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"event":"closed","created_at":"2021-07-05T00:00:00Z","actor":{"login":"triager"},"issue":{"number":4}},
+			{"event":"labeled","created_at":"2021-07-04T00:00:00Z","actor":{"login":"triager"},"issue":{"number":4}},
+			{"event":"closed","created_at":"2021-07-03T00:00:00Z","actor":{"login":"triager"},"issue":{"number":3,"pull_request":{"url":"x"}}},
+			{"event":"closed","created_at":"2021-06-03T00:00:00Z","actor":{"login":"triager"},"issue":{"number":2}}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/issues/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"created_at":"2021-07-02T00:00:00Z","user":{"login":"triager"},"html_url":"https://github.com/test-org/repo/issues/4#issuecomment-1"},
+			{"created_at":"2021-07-02T00:00:00Z","user":{"login":"triager"},"html_url":"https://github.com/test-org/repo/issues/4#issuecomment-2"},
+			{"created_at":"2021-07-02T00:00:00Z","user":{"login":"triager"},"html_url":"https://github.com/test-org/repo/pull/3#issuecomment-3"}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:              []string{"test-org"},
+		From:              time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		IncludeIssueStats: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"triager"}, stats.Logins())
+	expected := Stat{IssuesOpened: 1, IssuesClosed: 1, IssueComments: 2}
+	assert.Equal(t, expected, stats.For("triager"))
+	assert.Equal(t, expected, stats.ForRepo("triager", "test-org/repo"))
+}
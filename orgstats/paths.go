@@ -0,0 +1,79 @@
+package orgstats
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// validatePathPatterns checks that the given exclusion patterns are valid.
+func validatePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isExcludedPath checks whether the given path, relative to the root of the
+// repository, matches any of the given patterns.
+func isExcludedPath(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a path against a glob pattern, as in .gitignore files:
+// patterns without a slash match the file name in any directory, and **
+// matches any number of directories. For instance, vendor/** matches all
+// files in the vendor directory and *.pb.go matches all such files.
+func matchPath(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// try to match the rest of the pattern at every depth
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// renamedPath returns the new path of a file in a numstat line, which git
+// shows as "old => new" or "dir/{old => new}/file" for renamed files.
+func renamedPath(p string) string {
+	if open := strings.Index(p, "{"); open >= 0 {
+		if end := strings.Index(p[open:], "}"); end >= 0 {
+			if _, to, ok := strings.Cut(p[open+1:open+end], " => "); ok {
+				return path.Clean(p[:open] + to + p[open+end+1:])
+			}
+		}
+	}
+	if _, to, ok := strings.Cut(p, " => "); ok {
+		return to
+	}
+	return p
+}
@@ -0,0 +1,50 @@
+package orgstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"vendor/**", "vendor/github.com/foo/bar.go", true},
+		{"vendor/**", "pkg/vendor/bar.go", false},
+		{"**/vendor/**", "pkg/vendor/bar.go", true},
+		{"*.pb.go", "api/v1/service.pb.go", true},
+		{"*.pb.go", "api/v1/service.go", false},
+		{"package-lock.json", "web/package-lock.json", true},
+		{"/docs/*.md", "docs/index.md", true},
+		{"docs/*.md", "docs/api/index.md", false},
+		{"docs/**/*.md", "docs/index.md", true},
+		{"docs/**/*.md", "docs/api/index.md", true},
+	} {
+		assert.Equal(t, tt.match, matchPath(tt.pattern, tt.path), "%s %s", tt.pattern, tt.path)
+	}
+}
+
+func TestRenamedPath(t *testing.T) {
+	for p, expected := range map[string]string{
+		"main.go":                    "main.go",
+		"old.go => new.go":           "new.go",
+		"pkg/{old => new}/file.go":   "pkg/new/file.go",
+		"pkg/{ => vendor}/file.go":   "pkg/vendor/file.go",
+		"{vendor => third}/lib/a.go": "third/lib/a.go",
+	} {
+		assert.Equal(t, expected, renamedPath(p), p)
+	}
+}
+
+func TestValidatePathPatterns(t *testing.T) {
+	assert.NoError(t, validatePathPatterns([]string{"vendor/**", "*.pb.go"}))
+	assert.Error(t, validatePathPatterns([]string{"[vendor"}))
+}
+
+func TestValidateExcludePaths(t *testing.T) {
+	assert.NoError(t, Validate(Options{Backend: BackendGit, ExcludePaths: []string{"vendor/**"}}))
+	assert.EqualError(t, Validate(Options{ExcludePaths: []string{"vendor/**"}}), "excluding paths requires the git backend")
+	assert.Error(t, Validate(Options{Backend: BackendGit, ExcludePaths: []string{"[vendor"}}))
+}
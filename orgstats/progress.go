@@ -0,0 +1,61 @@
+package orgstats
+
+import (
+	"context"
+	"time"
+)
+
+// ProgressKind identifies what a Progress event is about
+type ProgressKind int
+
+const (
+	// ProgressRepos reports how many repositories will be scanned
+	ProgressRepos ProgressKind = iota
+	// ProgressRepoStarted reports that a repository started to be scanned
+	ProgressRepoStarted
+	// ProgressRepoDone reports that a repository was scanned
+	ProgressRepoDone
+	// ProgressReviews reports that reviews of a user started to be gathered
+	ProgressReviews
+	// ProgressPullRequests reports that pull requests of a user started to
+	// be gathered
+	ProgressPullRequests
+	// ProgressRateLimit reports that all requests are paused until a rate
+	// limit resets
+	ProgressRateLimit
+)
+
+// Progress is an event emitted by Gather as it makes progress
+type Progress struct {
+	Kind ProgressKind
+
+	// Done and Total count the repositories, or users when gathering reviews or pull requests.
+	Done, Total int
+
+	// Repo is the full name of the repository the event is about, if any.
+	Repo string
+
+	// User is the login the event is about, if any.
+	User string
+
+	// Until is when requests will resume after hitting a rate limit.
+	Until time.Time
+}
+
+type progressKey struct{}
+
+// withProgress returns a context carrying the given progress callback, so
+// it can be reached from deep down the call stack, e.g. on rate limits.
+func withProgress(ctx context.Context, fn func(Progress)) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// report sends the given event to the progress callback in ctx, if any.
+func report(ctx context.Context, p Progress) {
+	if fn, ok := ctx.Value(progressKey{}).(func(Progress)); ok {
+		fn(p)
+	}
+}
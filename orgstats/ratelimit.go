@@ -0,0 +1,79 @@
+package orgstats
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	githuberrors "github.com/caarlos0/org-stats/github_errors"
+	"github.com/google/go-github/v39/github"
+)
+
+// rateLimitGate makes concurrent workers pause together: once any of them
+// hits a rate limit, every subsequent call waits until the limit resets.
+type rateLimitGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+var gate rateLimitGate
+
+// pauseUntil extends the pause so no call is made before t.
+func (g *rateLimitGate) pauseUntil(t time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if t.After(g.until) {
+		g.until = t
+	}
+}
+
+// wait blocks while the gate is paused, or until ctx is done.
+func (g *rateLimitGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	until := g.until
+	g.mu.Unlock()
+	return sleep(ctx, time.Until(until))
+}
+
+// sleep pauses for the given duration, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func handleRateLimit(ctx context.Context, err *github.RateLimitError) error {
+	s := err.Rate.Reset.UTC().Sub(time.Now().UTC())
+	if s < 0 {
+		s = 5 * time.Second
+	}
+	log.Printf("hit rate limit, waiting %v", s)
+	until := time.Now().Add(s)
+	gate.pauseUntil(until)
+	report(ctx, Progress{Kind: ProgressRateLimit, Until: until})
+	return gate.wait(ctx)
+}
+
+func handleSecondaryRateLimit(ctx context.Context, err *githuberrors.SecondaryRateLimitError) error {
+	s := 10 * time.Second
+	if err.RetryAfter != nil {
+		s = err.RetryAfter.UTC().Sub(time.Now().UTC())
+	}
+	if s < 0 {
+		s = 10 * time.Second
+	}
+	log.Printf("hit secondary rate limit, waiting %v", s)
+	until := time.Now().Add(s)
+	gate.pauseUntil(until)
+	report(ctx, Progress{Kind: ProgressRateLimit, Until: until})
+	return gate.wait(ctx)
+}
@@ -0,0 +1,30 @@
+package orgstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRateLimitWaitIsCancellable tests that waiting for a rate limit to reset
+// stops as soon as the context is cancelled
+func TestRateLimitWaitIsCancellable(t *testing.T) {
+	defer func() { gate = rateLimitGate{} }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := handleRateLimit(ctx, &github.RateLimitError{
+		Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}},
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Minute)
+
+	// other workers are paused as well
+	assert.ErrorIs(t, gate.wait(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,123 @@
+package orgstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	githuberrors "github.com/caarlos0/org-stats/github_errors"
+	"github.com/google/go-github/v39/github"
+)
+
+// ErrStatsPending is returned when GitHub is still computing the requested
+// statistics after all retry attempts.
+var ErrStatsPending = errors.New("stats pending")
+
+// RetryPolicy configures how API calls are retried when GitHub is still
+// computing their results, or when they time out.
+// Rate limit waits are not counted as attempts.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a call is made before giving up.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, doubling on each
+	// subsequent retry up to MaxBackoff. Waits are jittered.
+	InitialBackoff, MaxBackoff time.Duration
+
+	// Timeout bounds each call, zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy is used when Options.Retry is left empty.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    8,
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     time.Minute,
+	Timeout:        time.Minute,
+}
+
+// orDefault returns the default policy if p is empty.
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p == (RetryPolicy{}) {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// backoff returns how long to wait before the given retry, with jitter.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// wait between half and the whole backoff, so workers retrying at
+	// the same time spread out
+	return d/2 + rand.N(d/2+1)
+}
+
+// do calls fn until it succeeds or fails for good, waiting out rate limits
+// and retrying with backoff while GitHub is still computing the results or
+// the call times out.
+func (p RetryPolicy) do(ctx context.Context, what string, fn func(ctx context.Context) (*github.Response, error)) error {
+	p = p.orDefault()
+	attempts := 0
+	for {
+		if err := gate.wait(ctx); err != nil {
+			return err
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+		}
+		resp, err := fn(callCtx)
+		cancel()
+
+		if rateErr, ok := err.(*github.RateLimitError); ok {
+			if err := handleRateLimit(ctx, rateErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if isSecondRateErr, secondRateErr := githuberrors.IsSecondaryRateLimitError(resp); isSecondRateErr {
+			if err := handleSecondaryRateLimit(ctx, secondRateErr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var acceptedErr *github.AcceptedError
+		pending := errors.As(err, &acceptedErr)
+		timedOut := errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+		if !pending && !timedOut {
+			return err
+		}
+
+		attempts++
+		if attempts >= p.MaxAttempts {
+			if pending {
+				return fmt.Errorf("%s: %w after %d attempts", what, ErrStatsPending, attempts)
+			}
+			return fmt.Errorf("%s: timed out after %d attempts: %w", what, attempts, err)
+		}
+
+		wait := p.backoff(attempts)
+		if pending {
+			log.Printf("%s: github is still computing the results, retrying in %v", what, wait)
+		} else {
+			log.Printf("%s: timed out, retrying in %v", what, wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStatsNeverReady tests that repositories whose stats GitHub never finishes
+// computing are reported as pending instead of being retried forever
+func TestStatsNeverReady(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"ready"},{"name":"computing"}]`))
+	})
+	mux.HandleFunc("/repos/test-org/ready/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"org-member"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+	var attempts int
+	mux.HandleFunc("/repos/test-org/computing/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherLineStats(context.Background(), client, Options{
+		Orgs:        []string{"test-org"},
+		Concurrency: 1,
+		Retry: RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		},
+	}, map[string]bool{"org-member": true}, &stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []string{"test-org/computing"}, stats.Pending())
+	assert.Equal(t, Stat{Additions: 10, Deletions: 2, Commits: 1}, stats.For("org-member"))
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for retry, max := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		d := p.backoff(retry)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+}
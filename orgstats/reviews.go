@@ -0,0 +1,154 @@
+package orgstats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// getReviewActions returns, for each pull request of the given repository
+// updated within the time window, whether each reviewer approved it,
+// requested changes or only commented on it, along with every inline review
+// comment made within the window.
+func getReviewActions(ctx context.Context, client *github.Client, retry RetryPolicy, owner, name string, from, to time.Time) ([]action, error) {
+	var actions []action
+
+	// most recently updated first, so stop once they are older than from
+	prOpts := &github.PullRequestListOptions{
+		State:       "all",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+prs:
+	for {
+		var prs []*github.PullRequest
+		var resp *github.Response
+		if err := retry.do(ctx, "list pull requests of "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			prs, resp, err = client.PullRequests.List(ctx, owner, name, prOpts)
+			return resp, err
+		}); err != nil {
+			return actions, fmt.Errorf("failed to list pull requests of %s/%s: %w", owner, name, err)
+		}
+		for _, pr := range prs {
+			if pr.GetUpdatedAt().Before(from) {
+				break prs
+			}
+			reviews, err := getReviewVerdicts(ctx, client, retry, owner, name, pr.GetNumber(), from, to)
+			if err != nil {
+				return actions, err
+			}
+			actions = append(actions, reviews...)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		prOpts.Page = resp.NextPage
+	}
+
+	commentOpts := &github.PullRequestListCommentsOptions{
+		Since:       from,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		var comments []*github.PullRequestComment
+		var resp *github.Response
+		if err := retry.do(ctx, "list review comments of "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			comments, resp, err = client.PullRequests.ListComments(ctx, owner, name, 0, commentOpts)
+			return resp, err
+		}); err != nil {
+			return actions, fmt.Errorf("failed to list review comments of %s/%s: %w", owner, name, err)
+		}
+		for _, comment := range comments {
+			actions = append(actions, action{
+				login:    comment.GetUser().GetLogin(),
+				userType: comment.GetUser().GetType(),
+				kind:     reviewComment,
+				when:     comment.GetCreatedAt(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		commentOpts.Page = resp.NextPage
+	}
+
+	return actions, nil
+}
+
+// getReviewVerdicts returns one action per reviewer of the given pull
+// request, based on the reviews they submitted within the time window:
+// reviewApproved and/or reviewChangesRequested, or reviewCommented if they
+// did neither.
+func getReviewVerdicts(ctx context.Context, client *github.Client, retry RetryPolicy, owner, name string, number int, from, to time.Time) ([]action, error) {
+	type verdict struct {
+		approved, changesRequested, commented time.Time
+	}
+	var reviewers []string
+	verdicts := map[string]*verdict{}
+	userTypes := map[string]string{}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var reviews []*github.PullRequestReview
+		var resp *github.Response
+		if err := retry.do(ctx, fmt.Sprintf("list reviews of %s/%s#%d", owner, name, number), func(ctx context.Context) (*github.Response, error) {
+			var err error
+			reviews, resp, err = client.PullRequests.ListReviews(ctx, owner, name, number, opts)
+			return resp, err
+		}); err != nil {
+			return nil, fmt.Errorf("failed to list reviews of %s/%s#%d: %w", owner, name, number, err)
+		}
+		for _, review := range reviews {
+			login, when := review.GetUser().GetLogin(), review.GetSubmittedAt()
+			if login == "" || (!from.IsZero() && when.Before(from)) || (!to.IsZero() && when.After(to)) {
+				continue
+			}
+			v := verdicts[login]
+			if v == nil {
+				v = &verdict{}
+				verdicts[login] = v
+				reviewers = append(reviewers, login)
+				userTypes[login] = review.GetUser().GetType()
+			}
+			// keep the time of the first review of each kind
+			switch review.GetState() {
+			case "APPROVED":
+				if v.approved.IsZero() {
+					v.approved = when
+				}
+			case "CHANGES_REQUESTED":
+				if v.changesRequested.IsZero() {
+					v.changesRequested = when
+				}
+			case "COMMENTED":
+				if v.commented.IsZero() {
+					v.commented = when
+				}
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	var actions []action
+	for _, login := range reviewers {
+		v, userType := verdicts[login], userTypes[login]
+		if !v.approved.IsZero() {
+			actions = append(actions, action{login: login, userType: userType, kind: reviewApproved, when: v.approved})
+		}
+		if !v.changesRequested.IsZero() {
+			actions = append(actions, action{login: login, userType: userType, kind: reviewChangesRequested, when: v.changesRequested})
+		}
+		if v.approved.IsZero() && v.changesRequested.IsZero() && !v.commented.IsZero() {
+			actions = append(actions, action{login: login, userType: userType, kind: reviewCommented, when: v.commented})
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,93 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGatherReviewDepth tests that reviews are broken down per pull request
+// by the verdict of each reviewer, within the time window
+func TestGatherReviewDepth(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"stamper","id":1},{"login":"thorough","id":2},{"login":"approve-helper","id":3}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"number":1,"updated_at":"2021-07-10T00:00:00Z"},
+			{"number":2,"updated_at":"2021-07-05T00:00:00Z"},
+			{"number":3,"updated_at":"2021-06-05T00:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"user":{"login":"thorough"},"state":"COMMENTED","submitted_at":"2021-07-02T00:00:00Z"},
+			{"user":{"login":"thorough"},"state":"CHANGES_REQUESTED","submitted_at":"2021-07-03T00:00:00Z"},
+			{"user":{"login":"thorough"},"state":"APPROVED","submitted_at":"2021-07-04T00:00:00Z"},
+			{"user":{"login":"stamper"},"state":"APPROVED","submitted_at":"2021-07-02T00:00:00Z"},
+			{"user":{"login":"approve-helper","type":"Bot"},"state":"APPROVED","submitted_at":"2021-07-02T00:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/pulls/2/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"user":{"login":"thorough"},"state":"COMMENTED","submitted_at":"2021-07-02T00:00:00Z"},
+			{"user":{"login":"thorough"},"state":"COMMENTED","submitted_at":"2021-07-03T00:00:00Z"},
+			{"user":{"login":"stamper"},"state":"APPROVED","submitted_at":"2021-06-02T00:00:00Z"}
+		]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/pulls/3/reviews", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("pull requests not updated within the window should not be listed")
+	})
+	mux.HandleFunc("/repos/test-org/repo/pulls/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"user":{"login":"thorough"},"created_at":"2021-07-02T00:00:00Z"},
+			{"user":{"login":"thorough"},"created_at":"2021-07-03T00:00:00Z"},
+			{"user":{"login":"thorough"},"created_at":"2021-07-03T00:00:00Z"}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:               []string{"test-org"},
+		From:               time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		IncludeReviewDepth: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stat{ReviewsApproved: 1}, stats.For("stamper"))
+	assert.Equal(t, Stat{
+		ReviewsApproved:         1,
+		ReviewsChangesRequested: 1,
+		ReviewsCommented:        1,
+		ReviewComments:          3,
+	}, stats.For("thorough"))
+	assert.Equal(t, "thorough", Sort(stats, ExtractReviewComments)[0].Key)
+	assert.NotContains(t, stats.Logins(), "approve-helper")
+}
@@ -25,6 +25,60 @@ var Reviews = func(st Stat) int {
 	return st.Reviews
 }
 
+// ExtractPullRequestsOpened extract the opened prs section of the given stat
+var ExtractPullRequestsOpened = func(st Stat) int {
+	return st.PullRequestsOpened
+}
+
+// ExtractPullRequestsMerged extract the merged prs section of the given stat
+var ExtractPullRequestsMerged = func(st Stat) int {
+	return st.PullRequestsMerged
+}
+
+// ExtractPullRequestsClosed extract the closed without merging prs section
+// of the given stat
+var ExtractPullRequestsClosed = func(st Stat) int {
+	return st.PullRequestsClosed
+}
+
+// ExtractIssuesOpened extract the opened issues section of the given stat
+var ExtractIssuesOpened = func(st Stat) int {
+	return st.IssuesOpened
+}
+
+// ExtractIssuesClosed extract the closed issues section of the given stat
+var ExtractIssuesClosed = func(st Stat) int {
+	return st.IssuesClosed
+}
+
+// ExtractIssueComments extract the issue comments section of the given stat
+var ExtractIssueComments = func(st Stat) int {
+	return st.IssueComments
+}
+
+// ExtractReviewsApproved extract the approved prs section of the given stat
+var ExtractReviewsApproved = func(st Stat) int {
+	return st.ReviewsApproved
+}
+
+// ExtractReviewsChangesRequested extract the prs with changes requested
+// section of the given stat
+var ExtractReviewsChangesRequested = func(st Stat) int {
+	return st.ReviewsChangesRequested
+}
+
+// ExtractReviewsCommented extract the prs only commented on section of the
+// given stat
+var ExtractReviewsCommented = func(st Stat) int {
+	return st.ReviewsCommented
+}
+
+// ExtractReviewComments extract the inline review comments section of the
+// given stat
+var ExtractReviewComments = func(st Stat) int {
+	return st.ReviewComments
+}
+
 func Sort(s Stats, extract Extract) []StatPair {
 	var result []StatPair
 	for key, value := range s.data {
@@ -36,6 +90,59 @@ func Sort(s Stats, extract Extract) []StatPair {
 	return result
 }
 
+// SortRepos ranks the repositories the given login contributed to.
+func SortRepos(s Stats, login string, extract Extract) []StatPair {
+	var result []StatPair
+	for key, value := range s.repos[login] {
+		result = append(result, StatPair{Key: key, Value: extract(value)})
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+	return result
+}
+
+// SortContributors ranks the contributors of the given repository.
+func SortContributors(s Stats, repo string, extract Extract) []StatPair {
+	var result []StatPair
+	for login, byRepo := range s.repos {
+		if value, ok := byRepo[repo]; ok {
+			result = append(result, StatPair{Key: login, Value: extract(value)})
+		}
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+	return result
+}
+
+// SortTeams ranks the teams gathered along with the stats.
+func SortTeams(s Stats, extract Extract) []StatPair {
+	var result []StatPair
+	for team := range s.teams {
+		result = append(result, StatPair{Key: team, Value: extract(s.ForTeam(team))})
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+	return result
+}
+
+// SortTeamMembers ranks the members of the given team, leaving bots out.
+func SortTeamMembers(s Stats, team string, extract Extract) []StatPair {
+	var result []StatPair
+	for _, login := range s.teams[team] {
+		if s.bots[login] {
+			continue
+		}
+		result = append(result, StatPair{Key: login, Value: extract(s.data[login])})
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+	return result
+}
+
 type StatPair struct {
 	Key   string
 	Value int
@@ -2,25 +2,144 @@ package orgstats
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	githuberrors "github.com/caarlos0/org-stats/github_errors"
-
 	"github.com/google/go-github/v39/github"
+	"golang.org/x/sync/errgroup"
 )
 
 // Stat represents an user adds, rms and commits count
 type Stat struct {
 	Additions, Deletions, Commits, Reviews int
+
+	// PullRequestsOpened, PullRequestsMerged and PullRequestsClosed count
+	// the pull requests authored by the user, closed meaning closed without
+	// being merged.
+	PullRequestsOpened, PullRequestsMerged, PullRequestsClosed int
+
+	// IssuesOpened, IssuesClosed and IssueComments count the activity of
+	// the user on issues, pull requests excluded.
+	IssuesOpened, IssuesClosed, IssueComments int
+
+	// ReviewsApproved, ReviewsChangesRequested and ReviewsCommented count
+	// the pull requests the user approved, requested changes on, or only
+	// commented on when reviewing. ReviewComments counts the inline review
+	// comments of the user.
+	ReviewsApproved, ReviewsChangesRequested, ReviewsCommented, ReviewComments int
+}
+
+// Week represents an user adds, rms and commits count on a given week
+type Week struct {
+	Start                         time.Time
+	Additions, Deletions, Commits int
 }
 
-// Stats contains the user->Stat mapping
+// Stats contains the user->Stat mapping, as well as the user->repo->Stat
+// breakdown and the weekly buckets it was built from
 type Stats struct {
-	data  map[string]Stat
-	since time.Time
+	data     map[string]Stat
+	repos    map[string]map[string]Stat
+	weeks    map[string]map[string]map[int64]Week
+	teams    map[string][]string
+	bots     map[string]bool
+	pending  []string
+	from, to time.Time
+
+	// unattributed holds the stats of commits whose author couldn't be
+	// identified, by email
+	unattributed map[string]Stat
+
+	// identities maps authors to the logins their stats are recorded under
+	identities IdentityMap
+}
+
+// Backend is the API used to gather stats
+type Backend string
+
+const (
+	// BackendREST gathers weekly contributor stats and searches reviews
+	// using the REST API.
+	BackendREST Backend = "rest"
+	// BackendGraphQL gathers the commit history and review contributions
+	// using the GraphQL API, with exact time boundaries.
+	BackendGraphQL Backend = "graphql"
+	// BackendGit mirror-clones every repository and reads its commit
+	// history with the git command line, with exact time boundaries.
+	// Reviews are searched using the REST API.
+	BackendGit Backend = "git"
+)
+
+// Options configures which data Gather collects and how
+type Options struct {
+	Orgs                         []string
+	UserBlacklist, RepoBlacklist []string
+	UserWhitelist, RepoWhitelist []string
+
+	// Repos, if set, are the full names (owner/name) of the repositories
+	// to scan, instead of all repositories of the organizations.
+	Repos []string
+
+	// AllContributors counts every contributor, instead of only members
+	// of the organizations and whitelisted users.
+	AllContributors bool
+
+	// Bots are left out unless IncludeBots is set, in which case they are
+	// marked, see Stats.IsBot. Bots are accounts GitHub says are bots,
+	// logins ending with [bot] and logins matching any of BotPatterns.
+	IncludeBots bool
+	BotPatterns []*regexp.Regexp
+
+	// From and To bound the time window to gather stats from, zero values
+	// leave the corresponding side unbounded.
+	From, To time.Time
+
+	IncludeReviewStats      bool
+	ReviewAllMembers        bool // gather reviews of all members, not only contributors
+	IncludePullRequestStats bool
+	IncludeIssueStats       bool
+	IncludeReviewDepth      bool
+	ExcludeForks            bool
+	IncludeTeams            bool   // gather the members of all teams, see Stats.ForTeam
+	Team                    string // only gather stats of the members of this team
+	Concurrency             int
+	Verbose                 bool
+
+	// Backend selects which API is used to gather the stats, BackendREST
+	// is used if empty.
+	Backend Backend
+
+	// CloneDir is the directory BackendGit keeps the mirrors of the
+	// repositories in, which are updated instead of cloned again on later
+	// runs. Token, if set, is used to clone private repositories.
+	CloneDir string
+	Token    string
+
+	// ExcludePaths are glob patterns of files whose lines are not counted,
+	// such as vendor/** or *.pb.go, see matchPath. They need per-file
+	// changes, which only BackendGit has.
+	ExcludePaths []string
+
+	// Retry configures how API calls are retried, DefaultRetryPolicy is
+	// used if empty.
+	Retry RetryPolicy
+
+	// Identities maps git author emails and alias logins to canonical
+	// logins, merging their stats. Emails can only be mapped with
+	// BackendGraphQL and BackendGit, as contributor stats don't include
+	// them.
+	Identities IdentityMap
+
+	// Progress, if set, is called as Gather makes progress. It may be called
+	// concurrently from several goroutines.
+	Progress func(Progress)
 }
 
 func (s Stats) Logins() []string {
@@ -35,115 +154,360 @@ func (s Stats) For(login string) Stat {
 	return s.data[login]
 }
 
-// NewStats return a new Stats map
-func NewStats(since time.Time) Stats {
+// ForRepo returns the stats of the given login on the given repository,
+// which is identified by its full name (owner/name).
+func (s Stats) ForRepo(login, repo string) Stat {
+	return s.repos[login][repo]
+}
+
+// Repos returns the full names of all repositories with recorded stats.
+func (s Stats) Repos() []string {
+	seen := map[string]bool{}
+	var repos []string
+	for _, byRepo := range s.repos {
+		for repo := range byRepo {
+			if seen[repo] {
+				continue
+			}
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// Orgs returns the owners of all repositories with recorded stats.
+func (s Stats) Orgs() []string {
+	var orgs []string
+	for _, repo := range s.Repos() {
+		if org := repoOwner(repo); !contains(orgs, org) {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// ForOrg returns the stats of the given login on the repositories owned by
+// the given organization. Only stats tracked per repository are included.
+func (s Stats) ForOrg(login, org string) Stat {
+	var total Stat
+	for repo, st := range s.repos[login] {
+		if repoOwner(repo) != org {
+			continue
+		}
+		total.Additions += st.Additions
+		total.Deletions += st.Deletions
+		total.Commits += st.Commits
+		total.IssuesOpened += st.IssuesOpened
+		total.IssuesClosed += st.IssuesClosed
+		total.IssueComments += st.IssueComments
+		total.ReviewsApproved += st.ReviewsApproved
+		total.ReviewsChangesRequested += st.ReviewsChangesRequested
+		total.ReviewsCommented += st.ReviewsCommented
+		total.ReviewComments += st.ReviewComments
+	}
+	return total
+}
+
+// uniqueFold returns the given names without repeats, ignoring case.
+func uniqueFold(names []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, name := range names {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// repoOwner returns the owner of the repository with the given full name.
+func repoOwner(repo string) string {
+	owner, _, _ := strings.Cut(repo, "/")
+	return owner
+}
+
+// ReposFor returns the full names of the repositories the given login has
+// recorded stats on.
+func (s Stats) ReposFor(login string) []string {
+	repos := make([]string, 0, len(s.repos[login]))
+	for repo := range s.repos[login] {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// Pending returns the full names of the repositories whose stats GitHub was
+// still computing when retries ran out, so they are missing from the stats.
+func (s Stats) Pending() []string {
+	pending := append([]string(nil), s.pending...)
+	sort.Strings(pending)
+	return pending
+}
+
+// Unattributed returns the stats of the commits whose author email couldn't
+// be attributed to any login, by email. They are left out of all other stats.
+func (s Stats) Unattributed() map[string]Stat {
+	unattributed := make(map[string]Stat, len(s.unattributed))
+	for email, st := range s.unattributed {
+		unattributed[email] = st
+	}
+	return unattributed
+}
+
+// Weeks returns the weekly stats of the given login on the given repository,
+// oldest first.
+func (s Stats) Weeks(login, repo string) []Week {
+	return sortWeeks(s.weeks[login][repo])
+}
+
+// WeeksFor returns the weekly stats of the given login summed across all
+// repositories, oldest first.
+func (s Stats) WeeksFor(login string) []Week {
+	merged := map[int64]Week{}
+	for _, weeks := range s.weeks[login] {
+		for key, week := range weeks {
+			m := merged[key]
+			m.Start = week.Start
+			m.Additions += week.Additions
+			m.Deletions += week.Deletions
+			m.Commits += week.Commits
+			merged[key] = m
+		}
+	}
+	return sortWeeks(merged)
+}
+
+func sortWeeks(weeks map[int64]Week) []Week {
+	result := make([]Week, 0, len(weeks))
+	for _, week := range weeks {
+		result = append(result, week)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// NewStats return a new Stats map, only counting activity between from and to
+func NewStats(from, to time.Time) Stats {
 	return Stats{
 		data:  make(map[string]Stat),
-		since: since,
+		repos: make(map[string]map[string]Stat),
+		weeks: make(map[string]map[string]map[int64]Week),
+		teams: make(map[string][]string),
+		bots:  make(map[string]bool),
+		from:  from,
+		to:    to,
+
+		unattributed: make(map[string]Stat),
 	}
 }
 
-// Gather a given organization's stats
-func Gather(
-	ctx context.Context,
-	client *github.Client,
-	org string,
-	userBlacklist, repoBlacklist []string,
-	userWhitelist, repoWhitelist []string,
-	since time.Time,
-	includeReviewStats bool,
-	excludeForks bool,
-	verbose bool,
-) (Stats, error) {
-	if verbose {
-		log.Println("Starting to gather stats for organization:", org)
-		log.Println("Options: includeReviewStats=", includeReviewStats, "excludeForks=", excludeForks)
-		if len(userWhitelist) > 0 || len(repoWhitelist) > 0 {
+// Gather the stats of the given organizations, merged per login. Members
+// of any of the organizations are considered members.
+//
+// If ctx is cancelled midway, the stats gathered so far are returned along
+// with the context's error.
+func Gather(ctx context.Context, client *github.Client, opts Options) (Stats, error) {
+	if opts.Verbose {
+		log.Println("Starting to gather stats for organizations:", strings.Join(opts.Orgs, ", "))
+		log.Println("Options: includeReviewStats=", opts.IncludeReviewStats, "excludeForks=", opts.ExcludeForks, "concurrency=", opts.Concurrency)
+		if len(opts.UserWhitelist) > 0 || len(opts.RepoWhitelist) > 0 {
 			log.Println("Using whitelist - will include specified users/repos even if not in organization")
 		}
-		if !since.IsZero() {
-			log.Println("Gathering stats since:", since.Format("2006-01-02 15:04:05"))
+		if !opts.From.IsZero() || !opts.To.IsZero() {
+			log.Println("Gathering stats from:", opts.From.Format("2006-01-02 15:04:05"), "to:", opts.To.Format("2006-01-02 15:04:05"))
 		} else {
 			log.Println("Gathering all stats (no time limit)")
 		}
 	}
 
-	allStats := NewStats(since)
-	if err := gatherLineStats(
-		ctx,
-		client,
-		org,
-		userBlacklist,
-		repoBlacklist,
-		userWhitelist,
-		repoWhitelist,
-		excludeForks,
-		&allStats,
-		verbose,
-	); err != nil {
+	if err := Validate(opts); err != nil {
 		return Stats{}, err
 	}
 
+	ctx = withProgress(ctx, opts.Progress)
+	allStats := NewStats(opts.From, opts.To)
+	allStats.identities = opts.Identities
+	orgMembers := map[string]bool{}
+	for _, org := range opts.Orgs {
+		members, err := getOrgMembers(ctx, client, opts.Retry, org, opts.Verbose)
+		if err != nil {
+			return partial(ctx, allStats, err)
+		}
+		for login := range members {
+			orgMembers[login] = true
+		}
+	}
+	if opts.IncludeTeams || opts.Team != "" {
+		if err := gatherTeams(ctx, client, opts, &allStats); err != nil {
+			return partial(ctx, allStats, err)
+		}
+	}
+	if opts.Team != "" {
+		// only members of the team are considered members from now on
+		orgMembers = map[string]bool{}
+		for _, login := range allStats.teams[opts.Team] {
+			orgMembers[login] = true
+		}
+	}
+	if err := gatherLineStats(ctx, client, opts, orgMembers, &allStats); err != nil {
+		return partial(ctx, allStats, err)
+	}
+
 	log.Println("total authors stats:", len(allStats.data))
 
-	if !includeReviewStats {
-		return allStats, nil
+	users := allStats.Logins()
+	if opts.IncludeReviewStats {
+		reviewers := users
+		if opts.ReviewAllMembers {
+			reviewers = allowedUsers(opts, orgMembers, users)
+		}
+		if err := gatherAllReviewStats(ctx, client, opts, reviewers, &allStats); err != nil {
+			return partial(ctx, allStats, err)
+		}
+	}
+
+	if opts.IncludePullRequestStats {
+		// pull requests of aliases are added to their canonical logins
+		users := allStats.identities.withAliases(users)
+		for i, user := range users {
+			log.Println("gathering pull request stats for user:", user)
+			report(ctx, Progress{Kind: ProgressPullRequests, Done: i, Total: len(users), User: user})
+			if err := gatherPullRequestStats(ctx, client, opts, user, &allStats); err != nil {
+				return partial(ctx, allStats, err)
+			}
+		}
 	}
 
-	if verbose {
+	if opts.IncludeBots {
+		// reviewers found by searches are only known by their logins
+		for login := range allStats.data {
+			if isBot(opts, login, "") {
+				allStats.bots[login] = true
+			}
+		}
+	}
+
+	return allStats, nil
+}
+
+// Validate checks that the given options can be gathered, which Gather
+// does before making any request.
+func Validate(opts Options) error {
+	if len(opts.ExcludePaths) > 0 && opts.Backend != BackendGit {
+		return fmt.Errorf("excluding paths requires the %s backend", BackendGit)
+	}
+	if err := validatePathPatterns(opts.ExcludePaths); err != nil {
+		return err
+	}
+	return validateFilters(opts)
+}
+
+// allowedUsers returns the given logins along with all organization members
+// and whitelisted users, leaving blacklisted users out.
+func allowedUsers(opts Options, orgMembers map[string]bool, logins []string) []string {
+	seen := map[string]bool{}
+	var users []string
+	for _, login := range logins {
+		seen[strings.ToLower(login)] = true
+		users = append(users, login)
+	}
+	var candidates []string
+	for _, login := range opts.UserWhitelist {
+		// patterns can't be searched, whitelisted users are only found
+		// through their contributions then
+		if isExactFilter(login) {
+			candidates = append(candidates, login)
+		}
+	}
+	for member := range orgMembers {
+		candidates = append(candidates, member)
+	}
+	sort.Strings(candidates)
+	for _, login := range candidates {
+		if seen[strings.ToLower(login)] || !isAllowed(opts, orgMembers, login) || (!opts.IncludeBots && isBot(opts, login, "")) {
+			continue
+		}
+		seen[strings.ToLower(login)] = true
+		users = append(users, login)
+	}
+	return users
+}
+
+// gatherAllReviewStats gathers the review stats of the given users, using
+// the configured backend.
+func gatherAllReviewStats(
+	ctx context.Context,
+	client *github.Client,
+	opts Options,
+	users []string,
+	allStats *Stats,
+) error {
+	if opts.Verbose {
 		log.Println("Starting to gather review stats for all contributors")
 	}
 
-	for user := range allStats.data {
+	// reviews of aliases are added to their canonical logins
+	users = allStats.identities.withAliases(users)
+
+	// contributions are counted per organization, so searches are used to
+	// count reviews on the given repositories only
+	if opts.Backend == BackendGraphQL && len(opts.Repos) == 0 {
+		return gatherGraphQLReviewStats(ctx, client, opts, users, allStats)
+	}
+
+	for i, user := range users {
 		log.Println("gathering review stats for user:", user)
-		if err := gatherReviewStats(
-			ctx,
-			client,
-			org,
-			user,
-			userBlacklist,
-			repoBlacklist,
-			&allStats,
-			since,
-			verbose,
-		); err != nil {
-			return Stats{}, err
+		report(ctx, Progress{Kind: ProgressReviews, Done: i, Total: len(users), User: user})
+		if err := gatherReviewStats(ctx, client, opts, user, allStats); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return allStats, nil
+// partial returns the stats gathered so far if ctx was cancelled, as
+// opposed to failing for any other reason.
+func partial(ctx context.Context, allStats Stats, err error) (Stats, error) {
+	if ctx.Err() != nil {
+		log.Println("stopped early, returning partial stats:", err)
+		return allStats, ctx.Err()
+	}
+	return Stats{}, err
 }
 
 func gatherReviewStats(
 	ctx context.Context,
 	client *github.Client,
-	org, user string,
-	userBlacklist, repoBlacklist []string,
+	opts Options,
+	user string,
 	allStats *Stats,
-	since time.Time,
-	verbose bool,
 ) error {
-	// We only process users that are already in allStats.data,
-	// which means they are organization members (filtered in gatherLineStats)
-	ts := since.Format("2006-01-02")
-
-	if verbose {
-		log.Printf("Gathering review stats for user %s in organization %s since %s", user, org, ts)
+	// users are contributors, or all allowed users with ReviewAllMembers,
+	// see allowedUsers
+	if opts.Verbose {
+		log.Printf("Gathering review stats for user %s in organizations %s", user, strings.Join(opts.Orgs, ", "))
 	}
 
-	// review:approved, review:changes_requested
-	query := fmt.Sprintf("user:%s is:pr reviewed-by:%s created:>%s", org, user, ts)
-	if verbose {
-		log.Printf("Executing search query: %s", query)
+	// counts reviewed pull requests only, see getReviewActions for the
+	// breakdown by review state
+	query := "is:pr reviewed-by:" + user
+	if created := dateQualifier("created", opts.From, opts.To); created != "" {
+		query += " " + created
 	}
 
-	reviewed, err := search(ctx, client, query)
+	reviewed, err := searchScoped(ctx, client, opts, query)
 	if err != nil {
 		log.Println("failed to gather review stats for user: ", user, "error: ", err)
 		return err
 	}
 
-	if verbose {
+	if opts.Verbose {
 		log.Printf("Found %d reviews for user %s", reviewed, user)
 	}
 
@@ -151,36 +515,144 @@ func gatherReviewStats(
 	return nil
 }
 
+// gatherPullRequestStats counts the pull requests the given user opened,
+// merged and closed without merging within the time window.
+func gatherPullRequestStats(
+	ctx context.Context,
+	client *github.Client,
+	opts Options,
+	user string,
+	allStats *Stats,
+) error {
+	base := "is:pr author:" + user
+	var counts [3]int
+	for i, q := range []struct{ filter, qualifier string }{
+		{"", "created"},
+		{"is:merged", "merged"},
+		{"is:closed is:unmerged", "closed"},
+	} {
+		query := base
+		if q.filter != "" {
+			query += " " + q.filter
+		}
+		if date := dateQualifier(q.qualifier, opts.From, opts.To); date != "" {
+			query += " " + date
+		}
+		count, err := searchScoped(ctx, client, opts, query)
+		if err != nil {
+			log.Println("failed to gather pull request stats for user: ", user, "error: ", err)
+			return err
+		}
+		counts[i] = count
+	}
+
+	if opts.Verbose {
+		log.Printf("Found %d opened, %d merged and %d closed pull requests for user %s", counts[0], counts[1], counts[2], user)
+	}
+	allStats.addPullRequestStats(user, counts[0], counts[1], counts[2])
+	return nil
+}
+
+// GitHub rejects search queries longer than maxSearchLength characters or
+// with more than five AND, OR or NOT operators, so repeated qualifiers, which
+// are implicitly ORed, are searched at most maxSearchScope at a time.
+const (
+	maxSearchLength = 256
+	maxSearchScope  = 5
+)
+
+// searchScoped counts the results of the given query on the given
+// repositories if set, or on the organizations otherwise. The scope is split
+// into as many searches as needed to stay within GitHub's limits, whose
+// counts are added up.
+func searchScoped(ctx context.Context, client *github.Client, opts Options, query string) (int, error) {
+	var total int
+	for _, q := range searchQueries(opts, query) {
+		if opts.Verbose {
+			log.Printf("Executing search query: %s", q)
+		}
+		count, err := search(ctx, client, opts.Retry, q)
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// searchQueries returns the given query scoped to chunks of the repositories
+// if set, or of the organizations otherwise, each within GitHub's limits.
+func searchQueries(opts Options, query string) []string {
+	var qualifiers []string
+	for _, repo := range uniqueFold(opts.Repos) {
+		qualifiers = append(qualifiers, "repo:"+repo)
+	}
+	if len(qualifiers) == 0 {
+		for _, org := range opts.Orgs {
+			qualifiers = append(qualifiers, "user:"+org)
+		}
+	}
+
+	var queries []string
+	var scope []string
+	flush := func() {
+		if len(scope) > 0 {
+			queries = append(queries, strings.Join(scope, " ")+" "+query)
+			scope = nil
+		}
+	}
+	for _, q := range qualifiers {
+		length := len(strings.Join(append(scope, q, query), " "))
+		if len(scope) == maxSearchScope || (len(scope) > 0 && length > maxSearchLength) {
+			flush()
+		}
+		scope = append(scope, q)
+	}
+	flush()
+	return queries
+}
+
+// dateQualifier builds a search qualifier such as created:2021-01-01..2021-03-31
+// matching the given window, or an empty string if the window is unbounded.
+func dateQualifier(qualifier string, from, to time.Time) string {
+	const layout = "2006-01-02"
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		return fmt.Sprintf("%s:%s..%s", qualifier, from.Format(layout), to.Format(layout))
+	case !from.IsZero():
+		return fmt.Sprintf("%s:>=%s", qualifier, from.Format(layout))
+	case !to.IsZero():
+		return fmt.Sprintf("%s:<=%s", qualifier, to.Format(layout))
+	default:
+		return ""
+	}
+}
+
 func search(
 	ctx context.Context,
 	client *github.Client,
+	retry RetryPolicy,
 	query string,
 ) (int, error) {
 	log.Printf("searching '%s'", query)
-	result, resp, err := client.Search.Issues(ctx, query, &github.SearchOptions{
-		ListOptions: github.ListOptions{
-			PerPage: 1,
-		},
-	})
-	if rateErr, ok := err.(*github.RateLimitError); ok {
-		handleRateLimit(rateErr)
-		return search(ctx, client, query)
-	}
-	if isSecondRateErr, secondRateErr := githuberrors.IsSecondaryRateLimitError(resp); isSecondRateErr {
-		handleSecondaryRateLimit(secondRateErr)
-		return search(ctx, client, query)
-	}
-	if _, ok := err.(*github.AcceptedError); ok {
-		return search(ctx, client, query)
-	}
-	if err != nil {
+	var result *github.IssuesSearchResult
+	if err := retry.do(ctx, "search "+query, func(ctx context.Context) (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		result, resp, err = client.Search.Issues(ctx, query, &github.SearchOptions{
+			ListOptions: github.ListOptions{
+				PerPage: 1,
+			},
+		})
+		return resp, err
+	}); err != nil {
 		return 0, fmt.Errorf("failed to search: %s: %w", query, err)
 	}
-	return *result.Total, nil
+	return result.GetTotal(), nil
 }
 
 // getOrgMembers returns a map of organization members for quick lookup
-func getOrgMembers(ctx context.Context, client *github.Client, org string, verbose bool) (map[string]bool, error) {
+func getOrgMembers(ctx context.Context, client *github.Client, retry RetryPolicy, org string, verbose bool) (map[string]bool, error) {
 	if verbose {
 		log.Printf("Getting organization members for %s", org)
 	}
@@ -201,16 +673,13 @@ func getOrgMembers(ctx context.Context, client *github.Client, org string, verbo
 			log.Printf("Fetching page %d of organization members", pageCount)
 		}
 
-		users, resp, err := client.Organizations.ListMembers(ctx, org, opt)
-		if rateErr, ok := err.(*github.RateLimitError); ok {
-			handleRateLimit(rateErr)
-			continue
-		}
-		if isSecondRateErr, secondRateErr := githuberrors.IsSecondaryRateLimitError(resp); isSecondRateErr {
-			handleSecondaryRateLimit(secondRateErr)
-			continue
-		}
-		if err != nil {
+		var users []*github.User
+		var resp *github.Response
+		if err := retry.do(ctx, "list members of "+org, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			users, resp, err = client.Organizations.ListMembers(ctx, org, opt)
+			return resp, err
+		}); err != nil {
 			return nil, fmt.Errorf("failed to list organization members: %w", err)
 		}
 
@@ -236,122 +705,279 @@ func getOrgMembers(ctx context.Context, client *github.Client, org string, verbo
 func gatherLineStats(
 	ctx context.Context,
 	client *github.Client,
-	org string,
-	userBlacklist, repoBlacklist []string,
-	userWhitelist, repoWhitelist []string,
-	excludeForks bool,
+	opts Options,
+	orgMembers map[string]bool,
 	allStats *Stats,
-	verbose bool,
 ) error {
-	if verbose {
-		log.Printf("Starting to gather line stats for organization %s", org)
+	if opts.Verbose {
+		log.Printf("Starting to gather line stats for organizations %s", strings.Join(opts.Orgs, ", "))
 	}
 
-	// Get organization members
-	orgMembers, err := getOrgMembers(ctx, client, org, verbose)
-	if err != nil {
-		return err
+	// whitelisted names are fetched one by one, while whitelisted patterns
+	// and selectors are matched against all repositories of the orgs
+	explicit := append([]string(nil), opts.Repos...)
+	var patterns []string
+	for _, w := range opts.RepoWhitelist {
+		if isExactFilter(w) {
+			explicit = append(explicit, w)
+		} else {
+			patterns = append(patterns, w)
+		}
 	}
 
-	if verbose {
-		log.Printf("Fetching repositories for organization %s", org)
+	var allRepos []*github.Repository
+	if len(explicit) > 0 {
+		if opts.Verbose {
+			log.Printf("Fetching given repositories: %v", explicit)
+		}
+		var err error
+		allRepos, err = whitelistedRepos(ctx, client, opts.Retry, opts.Orgs, uniqueFold(explicit))
+		if err != nil {
+			return err
+		}
+	}
+	// a repository given more than once, e.g. both as owner/name and by its
+	// name only, is scanned once
+	seen := map[string]bool{}
+	unique := allRepos[:0]
+	for _, repo := range allRepos {
+		name := strings.ToLower(repoName(repo, repo.GetOwner().GetLogin()))
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, repo)
+		}
+	}
+	allRepos = unique
+	if len(explicit) == 0 || len(patterns) > 0 {
+		for _, org := range opts.Orgs {
+			if opts.Verbose {
+				log.Printf("Fetching repositories for organization %s", org)
+			}
+			orgRepos, err := repos(ctx, client, opts.Retry, org)
+			if err != nil {
+				return err
+			}
+			for _, repo := range orgRepos {
+				repo = withOwner(repo, org)
+				if (len(patterns) > 0 && !matchRepo(patterns, repo)) || seen[strings.ToLower(repoName(repo, org))] {
+					continue
+				}
+				allRepos = append(allRepos, repo)
+			}
+		}
 	}
 
-	allRepos, err := repos(ctx, client, org)
-	if err != nil {
-		return err
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
+	// contributor stats are fetched by a bounded pool of workers, while the
+	// results are merged into allStats one repository at a time.
+	var toScan []*github.Repository
 	for _, repo := range allRepos {
-		if verbose {
+		if opts.Verbose {
 			log.Printf("Processing repository: %s", repo.GetName())
 		}
 
-		if excludeForks && *repo.Fork {
+		if opts.ExcludeForks && *repo.Fork {
 			log.Println("ignoring forked repo:", repo.GetName())
 			continue
 		}
-		if isBlacklisted(repoBlacklist, repo.GetName()) {
+		if matchRepo(opts.RepoBlacklist, repo) {
 			log.Println("ignoring blacklisted repo:", repo.GetName())
 			continue
 		}
+		toScan = append(toScan, repo)
+	}
 
-		if verbose {
-			log.Printf("Fetching contributor stats for repository %s", repo.GetName())
-		}
+	report(ctx, Progress{Kind: ProgressRepos, Total: len(toScan)})
 
-		stats, serr := getStats(ctx, client, org, *repo.Name)
-		if serr != nil {
-			return serr
-		}
+	var mu sync.Mutex
+	var done int
+	cache := &emailLogins{logins: map[string]string{}}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
 
-		if verbose {
-			log.Printf("Found %d contributors for repository %s", len(stats), repo.GetName())
-		}
+	for _, repo := range toScan {
+		g.Go(func() error {
+			owner := repo.GetOwner().GetLogin()
+			report(ctx, Progress{Kind: ProgressRepoStarted, Total: len(toScan), Repo: repoName(repo, owner)})
 
-		for _, cs := range stats {
-			if cs.Author == nil || cs.Author.GetLogin() == "" {
-				if verbose {
-					log.Println("Skipping contributor with no login")
+			name := repoName(repo, owner)
+
+			var stats []*github.ContributorStats
+			var commits []commit
+			var serr error
+			switch opts.Backend {
+			case BackendGraphQL:
+				if opts.Verbose {
+					log.Printf("Fetching commit history for repository %s", repo.GetName())
 				}
-				continue
+				commits, serr = getCommits(ctx, client, opts, owner, repo.GetName())
+			case BackendGit:
+				if opts.Verbose {
+					log.Printf("Reading git history of repository %s", repo.GetName())
+				}
+				commits, serr = getGitCommits(ctx, opts, repo.GetCloneURL(), owner, repo.GetName())
+				if serr == nil {
+					serr = attributeCommits(ctx, client, opts, owner, repo.GetName(), commits, cache)
+				}
+			default:
+				if opts.Verbose {
+					log.Printf("Fetching contributor stats for repository %s", repo.GetName())
+				}
+				stats, serr = getStats(ctx, client, opts.Retry, owner, repo.GetName())
+			}
+			pending := errors.Is(serr, ErrStatsPending)
+			if serr != nil && !pending {
+				return serr
 			}
 
-			// 检查用户是否在白名单中
-			isWhitelisted := isWhitelisted(userWhitelist, cs.Author.GetLogin())
+			var actions []action
+			if opts.IncludeIssueStats {
+				if opts.Verbose {
+					log.Printf("Fetching issue activity for repository %s", repo.GetName())
+				}
+				var err error
+				actions, err = getIssueActions(ctx, client, opts.Retry, owner, repo.GetName(), opts.From)
+				if err != nil {
+					return err
+				}
+			}
+			if opts.IncludeReviewDepth {
+				if opts.Verbose {
+					log.Printf("Fetching reviews for repository %s", repo.GetName())
+				}
+				reviews, err := getReviewActions(ctx, client, opts.Retry, owner, repo.GetName(), opts.From, opts.To)
+				if err != nil {
+					return err
+				}
+				actions = append(actions, reviews...)
+			}
 
-			// 如果用户不是组织成员且不在白名单中，则跳过
-			if !orgMembers[cs.Author.GetLogin()] && !isWhitelisted {
-				if verbose {
-					log.Printf("Checking if %s is an organization member: NO", cs.Author.GetLogin())
-					if !isWhitelisted {
-						log.Printf("%s is not in whitelist, skipping", cs.Author.GetLogin())
-					}
+			if opts.Verbose {
+				log.Printf("Found %d contributors and %d commits for repository %s", len(stats), len(commits), repo.GetName())
+			}
+
+			mu.Lock()
+			done++
+			// deferred first so it runs after unlocking, as the callback
+			// may block
+			defer report(ctx, Progress{Kind: ProgressRepoDone, Done: done, Total: len(toScan), Repo: name})
+			defer mu.Unlock()
+
+			memo := map[string]bool{}
+			allowed := func(login, userType string) bool {
+				if _, ok := memo[login]; !ok {
+					memo[login] = isAllowed(opts, orgMembers, login)
 				}
-				log.Println("ignoring non-organization member:", cs.Author.GetLogin())
-				continue
-			} else if verbose {
-				if orgMembers[cs.Author.GetLogin()] {
-					log.Printf("Checking if %s is an organization member: YES", cs.Author.GetLogin())
-				} else if isWhitelisted {
-					log.Printf("%s is in whitelist, including despite not being an organization member", cs.Author.GetLogin())
+				return memo[login] && allStats.allowBot(opts, login, userType)
+			}
+
+			// issue and review activity doesn't depend on the contributor
+			// stats, so it is recorded even if those are still pending
+			for _, a := range actions {
+				if login := allStats.identities.Resolve(a.login, ""); login != "" && allowed(login, a.userType) {
+					allStats.addAction(name, a)
 				}
 			}
 
-			if isBlacklisted(userBlacklist, cs.Author.GetLogin()) {
-				log.Println("ignoring blacklisted author:", cs.Author.GetLogin())
-				continue
+			if pending {
+				log.Println("giving up on repo, github is still computing its stats:", name)
+				allStats.pending = append(allStats.pending, name)
+				return nil
+			}
+			for _, cs := range stats {
+				if cs.Author == nil || cs.Author.GetLogin() == "" {
+					// contributor stats don't have the emails of
+					// unlinked authors, so they can't be claimed
+					if opts.Verbose {
+						log.Println("Skipping contributor with no login")
+					}
+					continue
+				}
+				login := allStats.identities.Resolve(cs.Author.GetLogin(), "")
+				if !allowed(login, cs.Author.GetType()) {
+					continue
+				}
+				log.Println("recording stats for", login, "on repo", repo.GetName())
+				allStats.add(name, cs)
 			}
 
-			// 记录用户统计信息
-			if orgMembers[cs.Author.GetLogin()] {
-				log.Println("recording stats for organization member", cs.Author.GetLogin(), "on repo", repo.GetName())
-			} else {
-				log.Println("recording stats for whitelisted user", cs.Author.GetLogin(), "on repo", repo.GetName())
+			for _, c := range commits {
+				login := allStats.identities.Resolve(c.login, c.email)
+				if login == "" {
+					if opts.Verbose {
+						log.Println("Skipping commit with no login:", c.email)
+					}
+					allStats.addUnattributed(c.email, c.when, c.additions, c.deletions)
+					continue
+				}
+				if allowed(login, "") {
+					allStats.addCommit(name, c.login, c.email, c.when, c.additions, c.deletions)
+				}
 			}
-			allStats.add(cs)
-		}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if n := len(allStats.unattributed); n > 0 {
+		log.Printf("left out the commits of %d emails not attributed to any login", n)
 	}
 	return nil
 }
 
+// isAllowed checks whether the stats of the given login should be recorded,
+// based on organization membership and the user whitelist and blacklist.
+func isAllowed(opts Options, orgMembers map[string]bool, login string) bool {
+	// 检查用户是否在白名单中
+	isWhitelisted := isWhitelisted(opts.UserWhitelist, login)
+
+	// 如果用户不是组织成员且不在白名单中，则跳过（统计所有贡献者时除外）
+	if !opts.AllContributors && !orgMembers[login] && !isWhitelisted {
+		if opts.Verbose {
+			log.Printf("Checking if %s is an organization member: NO", login)
+			log.Printf("%s is not in whitelist, skipping", login)
+		}
+		log.Println("ignoring non-organization member:", login)
+		return false
+	} else if opts.Verbose {
+		if orgMembers[login] {
+			log.Printf("Checking if %s is an organization member: YES", login)
+		} else if isWhitelisted {
+			log.Printf("%s is in whitelist, including despite not being an organization member", login)
+		}
+	}
+
+	if isBlacklisted(opts.UserBlacklist, login) {
+		log.Println("ignoring blacklisted author:", login)
+		return false
+	}
+	return true
+}
+
+// isBlacklisted checks whether s matches any of the blacklist entries,
+// which may be patterns, see matchFilter.
 func isBlacklisted(blacklist []string, s string) bool {
 	for _, b := range blacklist {
-		if strings.EqualFold(s, b) {
+		if matchFilter(b, s) {
 			return true
 		}
 	}
 	return false
 }
 
-// isWhitelisted 检查给定的字符串是否在白名单中
+// isWhitelisted 检查给定的字符串是否匹配白名单中的任一条目（支持模式）
 func isWhitelisted(whitelist []string, s string) bool {
 	if len(whitelist) == 0 {
 		return false
 	}
 
 	for _, w := range whitelist {
-		if strings.EqualFold(s, w) {
+		if matchFilter(w, s) {
 			return true
 		}
 	}
@@ -359,53 +985,157 @@ func isWhitelisted(whitelist []string, s string) bool {
 }
 
 func (s *Stats) addReviewStats(user string, reviewed int) {
+	user = s.identities.Resolve(user, "")
+	if _, ok := s.data[user]; !ok && reviewed == 0 {
+		// only members that reviewed are added, with no other stats
+		return
+	}
 	stat := s.data[user]
 	stat.Reviews += reviewed
 	s.data[user] = stat
 }
 
-func (s *Stats) add(cs *github.ContributorStats) {
+func (s *Stats) addPullRequestStats(user string, opened, merged, closed int) {
+	user = s.identities.Resolve(user, "")
+	stat := s.data[user]
+	stat.PullRequestsOpened += opened
+	stat.PullRequestsMerged += merged
+	stat.PullRequestsClosed += closed
+	s.data[user] = stat
+}
+
+func (s *Stats) add(repo string, cs *github.ContributorStats) {
 	if cs.GetAuthor() == nil {
 		return
 	}
-	stat := s.data[cs.GetAuthor().GetLogin()]
-	var adds int
-	var rms int
-	var commits int
+	var weeks []Week
 	for _, week := range cs.Weeks {
-		if !s.since.IsZero() && week.Week.Time.UTC().Before(s.since) {
+		if !s.from.IsZero() && week.Week.Time.UTC().Before(s.from) {
+			continue
+		}
+		if !s.to.IsZero() && week.Week.Time.UTC().After(s.to) {
 			continue
 		}
-		adds += *week.Additions
-		rms += *week.Deletions
-		commits += *week.Commits
+		weeks = append(weeks, Week{
+			Start:     week.Week.Time.UTC(),
+			Additions: week.GetAdditions(),
+			Deletions: week.GetDeletions(),
+			Commits:   week.GetCommits(),
+		})
+	}
+	s.addWeeks(s.identities.Resolve(cs.GetAuthor().GetLogin(), ""), repo, weeks)
+}
+
+// addCommit records a single commit, made at the given time.
+// Unlike weekly stats, commits are matched exactly against the time window.
+func (s *Stats) addCommit(repo, login, email string, when time.Time, adds, rms int) {
+	if !s.from.IsZero() && when.Before(s.from) {
+		return
+	}
+	if !s.to.IsZero() && when.After(s.to) {
+		return
+	}
+	s.addWeeks(s.identities.Resolve(login, email), repo, []Week{{
+		Start:     weekStart(when),
+		Additions: adds,
+		Deletions: rms,
+		Commits:   1,
+	}})
+}
+
+// addUnattributed records a single commit of an email that couldn't be
+// attributed to any login, matched exactly against the time window.
+func (s *Stats) addUnattributed(email string, when time.Time, adds, rms int) {
+	if !s.from.IsZero() && when.Before(s.from) {
+		return
+	}
+	if !s.to.IsZero() && when.After(s.to) {
+		return
+	}
+	st := s.unattributed[email]
+	st.Additions += adds
+	st.Deletions += rms
+	st.Commits++
+	s.unattributed[email] = st
+}
+
+// weekStart returns the start of the week of the given time, which is
+// Sunday at midnight UTC, as in GitHub's contributor stats.
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -int(day.Weekday()))
+}
+
+func (s *Stats) addWeeks(login, repo string, weeks []Week) {
+	var adds int
+	var rms int
+	var commits int
+	for _, week := range weeks {
+		adds += week.Additions
+		rms += week.Deletions
+		commits += week.Commits
+	}
+	if adds+rms+commits == 0 && (!s.from.IsZero() || !s.to.IsZero()) {
+		// ignore users with no activity when running with a time window
+		return
 	}
+
+	stat := s.data[login]
 	stat.Additions += adds
 	stat.Deletions += rms
 	stat.Commits += commits
-	if stat.Additions+stat.Deletions+stat.Commits == 0 && !s.since.IsZero() {
-		// ignore users with no activity when running with a since time
-		return
+	s.data[login] = stat
+
+	if s.repos[login] == nil {
+		s.repos[login] = make(map[string]Stat)
+	}
+	repoStat := s.repos[login][repo]
+	repoStat.Additions += adds
+	repoStat.Deletions += rms
+	repoStat.Commits += commits
+	s.repos[login][repo] = repoStat
+
+	if s.weeks[login] == nil {
+		s.weeks[login] = make(map[string]map[int64]Week)
 	}
-	s.data[cs.GetAuthor().GetLogin()] = stat
+	if s.weeks[login][repo] == nil {
+		s.weeks[login][repo] = make(map[int64]Week)
+	}
+	for _, week := range weeks {
+		if week.Additions+week.Deletions+week.Commits == 0 {
+			continue
+		}
+		w := s.weeks[login][repo][week.Start.Unix()]
+		w.Start = week.Start
+		w.Additions += week.Additions
+		w.Deletions += week.Deletions
+		w.Commits += week.Commits
+		s.weeks[login][repo][week.Start.Unix()] = w
+	}
+}
+
+// repoName returns the full name (owner/name) of the given repository.
+func repoName(repo *github.Repository, owner string) string {
+	if name := repo.GetFullName(); name != "" {
+		return name
+	}
+	return owner + "/" + repo.GetName()
 }
 
-func repos(ctx context.Context, client *github.Client, org string) ([]*github.Repository, error) {
+func repos(ctx context.Context, client *github.Client, retry RetryPolicy, org string) ([]*github.Repository, error) {
 	opt := &github.RepositoryListByOrgOptions{
 		ListOptions: github.ListOptions{PerPage: 10},
 	}
 	var allRepos []*github.Repository
 	for {
-		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
-		if rateErr, ok := err.(*github.RateLimitError); ok {
-			handleRateLimit(rateErr)
-			continue
-		}
-		if isSecondRateErr, secondRateErr := githuberrors.IsSecondaryRateLimitError(resp); isSecondRateErr {
-			handleSecondaryRateLimit(secondRateErr)
-			continue
-		}
-		if err != nil {
+		var repos []*github.Repository
+		var resp *github.Response
+		if err := retry.do(ctx, "list repositories of "+org, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			repos, resp, err = client.Repositories.ListByOrg(ctx, org, opt)
+			return resp, err
+		}); err != nil {
 			return allRepos, err
 		}
 		allRepos = append(allRepos, repos...)
@@ -419,38 +1149,68 @@ func repos(ctx context.Context, client *github.Client, org string) ([]*github.Re
 	return allRepos, nil
 }
 
-func getStats(ctx context.Context, client *github.Client, org, repo string) ([]*github.ContributorStats, error) {
-	stats, resp, err := client.Repositories.ListContributorsStats(ctx, org, repo)
-	if err != nil {
-		if rateErr, ok := err.(*github.RateLimitError); ok {
-			handleRateLimit(rateErr)
-			return getStats(ctx, client, org, repo)
+// whitelistedRepos gets the whitelisted repositories, given either as
+// owner/name or as a name, which is looked up in each of the organizations.
+func whitelistedRepos(ctx context.Context, client *github.Client, retry RetryPolicy, orgs []string, whitelist []string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	for _, w := range whitelist {
+		if owner, name, ok := strings.Cut(w, "/"); ok {
+			repo, err := getRepo(ctx, client, retry, owner, name)
+			if err != nil {
+				return allRepos, fmt.Errorf("failed to get whitelisted repo %s/%s: %w", owner, name, err)
+			}
+			allRepos = append(allRepos, withOwner(repo, owner))
+			continue
 		}
-		if isSecondRateErr, secondRateErr := githuberrors.IsSecondaryRateLimitError(resp); isSecondRateErr {
-			handleSecondaryRateLimit(secondRateErr)
-			return getStats(ctx, client, org, repo)
+
+		var found bool
+		for _, org := range orgs {
+			repo, err := getRepo(ctx, client, retry, org, w)
+			var errResp *github.ErrorResponse
+			if len(orgs) > 1 && errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+				continue
+			}
+			if err != nil {
+				return allRepos, fmt.Errorf("failed to get whitelisted repo %s/%s: %w", org, w, err)
+			}
+			allRepos = append(allRepos, withOwner(repo, org))
+			found = true
 		}
-		if _, ok := err.(*github.AcceptedError); ok {
-			return getStats(ctx, client, org, repo)
+		if !found {
+			return allRepos, fmt.Errorf("whitelisted repo %s not found in any of the organizations", w)
 		}
 	}
-	return stats, err
+
+	log.Println("got", len(allRepos), "whitelisted repositories")
+	return allRepos, nil
 }
 
-func handleRateLimit(err *github.RateLimitError) {
-	s := err.Rate.Reset.UTC().Sub(time.Now().UTC())
-	if s < 0 {
-		s = 5 * time.Second
+// withOwner sets the owner of the given repository, if missing.
+func withOwner(repo *github.Repository, owner string) *github.Repository {
+	if repo.GetOwner().GetLogin() == "" {
+		repo.Owner = &github.User{Login: github.String(owner)}
 	}
-	log.Printf("hit rate limit, waiting %v", s)
-	time.Sleep(s)
+	return repo
 }
 
-func handleSecondaryRateLimit(err *githuberrors.SecondaryRateLimitError) {
-	s := err.RetryAfter.UTC().Sub(time.Now().UTC())
-	if s < 0 {
-		s = 10 * time.Second
-	}
-	log.Printf("hit secondary rate limit, waiting %v", s)
-	time.Sleep(s)
+func getRepo(ctx context.Context, client *github.Client, retry RetryPolicy, owner, name string) (*github.Repository, error) {
+	var repo *github.Repository
+	err := retry.do(ctx, "get repository "+owner+"/"+name, func(ctx context.Context) (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		repo, resp, err = client.Repositories.Get(ctx, owner, name)
+		return resp, err
+	})
+	return repo, err
+}
+
+func getStats(ctx context.Context, client *github.Client, retry RetryPolicy, org, repo string) ([]*github.ContributorStats, error) {
+	var stats []*github.ContributorStats
+	err := retry.do(ctx, "get contributor stats of "+org+"/"+repo, func(ctx context.Context) (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		stats, resp, err = client.Repositories.ListContributorsStats(ctx, org, repo)
+		return resp, err
+	})
+	return stats, err
 }
@@ -2,10 +2,15 @@ package orgstats
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v39/github"
 	"github.com/stretchr/testify/assert"
@@ -33,7 +38,7 @@ func TestFilterNonOrgMembers(t *testing.T) {
 	client.UploadURL = url
 
 	// Get organization members
-	members, err := getOrgMembers(context.Background(), client, "test-org", true)
+	members, err := getOrgMembers(context.Background(), client, DefaultRetryPolicy, "test-org", true)
 
 	// Verify the results
 	assert.NoError(t, err)
@@ -42,3 +47,466 @@ func TestFilterNonOrgMembers(t *testing.T) {
 	assert.True(t, members["org-member"])
 	assert.False(t, members["non-org-member"])
 }
+
+// TestGatherLineStatsConcurrently tests that stats from many repositories are
+// merged correctly when fetched in parallel
+func TestGatherLineStatsConcurrently(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var repos []string
+	for i := 0; i < 20; i++ {
+		repos = append(repos, fmt.Sprintf(`{"name":"repo%d","fork":false}`, i))
+	}
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[" + strings.Join(repos, ",") + "]"))
+	})
+
+	mux.HandleFunc("/repos/test-org/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"org-member"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]},
+			{"author":{"login":"non-org-member"},"weeks":[{"w":1600000000,"a":5,"d":5,"c":5}]}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	var mu sync.Mutex
+	var done []int
+	ctx := withProgress(context.Background(), func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.Kind == ProgressRepoDone {
+			assert.Equal(t, 20, p.Total)
+			done = append(done, p.Done)
+		}
+	})
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherLineStats(ctx, client, Options{Orgs: []string{"test-org"}, Concurrency: 5}, map[string]bool{"org-member": true}, &stats)
+
+	assert.NoError(t, err)
+	assert.Len(t, done, 20)
+	assert.Contains(t, done, 20)
+	assert.Equal(t, []string{"org-member"}, stats.Logins())
+	assert.Equal(t, Stat{Additions: 200, Deletions: 40, Commits: 20}, stats.For("org-member"))
+	assert.Equal(t, []Week{{Start: time.Unix(1600000000, 0).UTC(), Additions: 200, Deletions: 40, Commits: 20}}, stats.WeeksFor("org-member"))
+	assert.Equal(t, []Week{{Start: time.Unix(1600000000, 0).UTC(), Additions: 10, Deletions: 2, Commits: 1}}, stats.Weeks("org-member", "test-org/repo3"))
+}
+
+// TestGatherLineStatsSlowProgress tests that a progress callback blocking
+// on one repository doesn't stop the others from being recorded
+func TestGatherLineStatsSlowProgress(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo1","fork":false},{"name":"repo2","fork":false}]`))
+	})
+	mux.HandleFunc("/repos/test-org/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"org-member"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	second := make(chan struct{})
+	ctx := withProgress(context.Background(), func(p Progress) {
+		if p.Kind != ProgressRepoDone {
+			return
+		}
+		if p.Done == 2 {
+			close(second)
+			return
+		}
+		// the first repository waits for the second one to be recorded
+		select {
+		case <-second:
+		case <-time.After(5 * time.Second):
+			t.Error("progress callback blocked the other repository")
+		}
+	})
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherLineStats(ctx, client, Options{Orgs: []string{"test-org"}, Concurrency: 2}, map[string]bool{"org-member": true}, &stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stat{Additions: 20, Deletions: 4, Commits: 2}, stats.For("org-member"))
+}
+
+// TestGatherLineStatsRepoWhitelist tests that only whitelisted repositories are
+// scanned, including repositories outside the organization
+func TestGatherLineStatsRepoWhitelist(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("should not list organization repositories when a repo whitelist is given")
+	})
+	mux.HandleFunc("/repos/test-org/inside", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"inside","full_name":"test-org/inside","owner":{"login":"test-org"}}`))
+	})
+	mux.HandleFunc("/repos/someone/outside", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"outside","full_name":"someone/outside","owner":{"login":"someone"}}`))
+	})
+	mux.HandleFunc("/repos/test-org/inside/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"org-member"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+	mux.HandleFunc("/repos/someone/outside/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"org-member"},"weeks":[{"w":1625961600,"a":1,"d":1,"c":1}]}]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherLineStats(context.Background(), client, Options{
+		Orgs:          []string{"test-org"},
+		RepoWhitelist: []string{"inside", "someone/outside"},
+		Concurrency:   2,
+	}, map[string]bool{"org-member": true}, &stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stat{Additions: 11, Deletions: 3, Commits: 2}, stats.For("org-member"))
+	assert.Equal(t, []string{"someone/outside", "test-org/inside"}, stats.Repos())
+	assert.Equal(t, Stat{Additions: 1, Deletions: 1, Commits: 1}, stats.ForRepo("org-member", "someone/outside"))
+	assert.Equal(t, Stat{Additions: 10, Deletions: 2, Commits: 1}, stats.ForRepo("org-member", "test-org/inside"))
+	assert.Equal(t, []StatPair{{Key: "org-member", Value: 10}}, SortContributors(stats, "test-org/inside", ExtractAdditions))
+}
+
+// TestGatherPullRequestStats tests that opened, merged and closed pull
+// requests are counted with their own searches
+func TestGatherPullRequestStats(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	counts := map[string]int{
+		"user:test-org is:pr author:org-member created:2021-07-01..2021-09-30":                      5,
+		"user:test-org is:pr author:org-member is:merged merged:2021-07-01..2021-09-30":             3,
+		"user:test-org is:pr author:org-member is:closed is:unmerged closed:2021-07-01..2021-09-30": 1,
+	}
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		count, ok := counts[q]
+		assert.True(t, ok, "unexpected query: %s", q)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"total_count":%d,"items":[]}`, count)
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats := NewStats(time.Time{}, time.Time{})
+	err := gatherPullRequestStats(context.Background(), client, Options{
+		Orgs: []string{"test-org"},
+		From: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2021, 9, 30, 0, 0, 0, 0, time.UTC),
+	}, "org-member", &stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stat{
+		PullRequestsOpened: 5,
+		PullRequestsMerged: 3,
+		PullRequestsClosed: 1,
+	}, stats.For("org-member"))
+	assert.Equal(t, "org-member", Sort(stats, ExtractPullRequestsMerged)[0].Key)
+}
+
+// TestGatherReviewStatsAllMembers tests that members without commits get
+// their reviews gathered, and are only added to the stats if they reviewed
+func TestGatherReviewStatsAllMembers(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"committer"},{"login":"reviewer"},{"login":"idle"},{"login":"blocked"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"committer"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+	reviews := map[string]int{"committer": 1, "reviewer": 4, "outsider": 2}
+	var mu sync.Mutex
+	var searched []string
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		var login string
+		fmt.Sscanf(r.URL.Query().Get("q"), "user:test-org is:pr reviewed-by:%s", &login)
+		mu.Lock()
+		searched = append(searched, login)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"total_count":%d,"items":[]}`, reviews[login])
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:               []string{"test-org"},
+		UserWhitelist:      []string{"outsider"},
+		UserBlacklist:      []string{"blocked"},
+		IncludeReviewStats: true,
+		ReviewAllMembers:   true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"committer", "idle", "outsider", "reviewer"}, searched)
+	assert.Equal(t, Stat{Additions: 10, Deletions: 2, Commits: 1, Reviews: 1}, stats.For("committer"))
+	assert.Equal(t, Stat{Reviews: 4}, stats.For("reviewer"))
+	assert.Equal(t, Stat{Reviews: 2}, stats.For("outsider"))
+	logins := stats.Logins()
+	sort.Strings(logins)
+	assert.Equal(t, []string{"committer", "outsider", "reviewer"}, logins)
+}
+
+// TestGatherMultipleOrgs tests that stats are merged across organizations,
+// counting members of any of them, and can be broken down per organization
+func TestGatherMultipleOrgs(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/main/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"}]`))
+	})
+	mux.HandleFunc("/orgs/infra/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"bob"}]`))
+	})
+	mux.HandleFunc("/orgs/main/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"app","full_name":"main/app","owner":{"login":"main"}}]`))
+	})
+	mux.HandleFunc("/orgs/infra/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"tf","full_name":"infra/tf","owner":{"login":"infra"}}]`))
+	})
+	mux.HandleFunc("/repos/main/app/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":1,"c":1}]},
+			{"author":{"login":"bob"},"weeks":[{"w":1600000000,"a":20,"d":2,"c":2}]}
+		]`))
+	})
+	mux.HandleFunc("/repos/infra/tf/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":40,"d":4,"c":4}]},
+			{"author":{"login":"outsider"},"weeks":[{"w":1600000000,"a":80,"d":8,"c":8}]}
+		]`))
+	})
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.URL.Query().Get("q"), "user:main user:infra is:pr reviewed-by:"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total_count":1,"items":[]}`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:               []string{"main", "infra"},
+		IncludeReviewStats: true,
+	})
+
+	assert.NoError(t, err)
+	logins := stats.Logins()
+	sort.Strings(logins)
+	assert.Equal(t, []string{"alice", "bob"}, logins)
+	assert.Equal(t, Stat{Additions: 50, Deletions: 5, Commits: 5, Reviews: 1}, stats.For("alice"))
+	assert.Equal(t, []string{"infra", "main"}, stats.Orgs())
+	assert.Equal(t, Stat{Additions: 40, Deletions: 4, Commits: 4}, stats.ForOrg("alice", "infra"))
+	assert.Equal(t, Stat{Additions: 10, Deletions: 1, Commits: 1}, stats.ForOrg("alice", "main"))
+	assert.Equal(t, Stat{}, stats.ForOrg("bob", "infra"))
+}
+
+// TestGatherExplicitRepos tests that the given repositories are scanned
+// without listing any organization, counting all contributors
+func TestGatherExplicitRepos(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL)
+	})
+	for _, repo := range []string{"main/app", "someone/lib"} {
+		mux.HandleFunc("/repos/"+repo, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			owner, name, _ := strings.Cut(repo, "/")
+			fmt.Fprintf(w, `{"name":%q,"full_name":%q,"owner":{"login":%q}}`, name, repo, owner)
+		})
+		mux.HandleFunc("/repos/"+repo+"/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[
+				{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":1,"c":1}]},
+				{"author":{"login":"blocked"},"weeks":[{"w":1600000000,"a":20,"d":2,"c":2}]}
+			]`))
+		})
+	}
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repo:main/app repo:someone/lib is:pr reviewed-by:alice", r.URL.Query().Get("q"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total_count":3,"items":[]}`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Repos:              []string{"main/app", "someone/lib"},
+		UserBlacklist:      []string{"blocked"},
+		AllContributors:    true,
+		IncludeReviewStats: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, stats.Logins())
+	assert.Equal(t, Stat{Additions: 20, Deletions: 2, Commits: 2, Reviews: 3}, stats.For("alice"))
+	assert.Equal(t, []string{"main/app", "someone/lib"}, stats.Repos())
+}
+
+// TestGatherDuplicatedRepos tests that a repository given several times is
+// only scanned and searched once
+func TestGatherDuplicatedRepos(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/main/app", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"app","full_name":"main/app","owner":{"login":"main"}}`))
+	})
+	mux.HandleFunc("/repos/main/app/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":2,"c":1}]}]`))
+	})
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repo:main/app is:pr reviewed-by:alice", r.URL.Query().Get("q"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"total_count":3,"items":[]}`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Repos:              []string{"main/app", "main/app", "Main/App"},
+		RepoWhitelist:      []string{"main/app"},
+		AllContributors:    true,
+		IncludeReviewStats: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Stat{Additions: 10, Deletions: 2, Commits: 1, Reviews: 3}, stats.For("alice"))
+	assert.Equal(t, []string{"main/app"}, stats.Repos())
+}
+
+// TestGatherManyExplicitRepos tests that searches on many repositories are
+// split to stay within GitHub's limits, adding up their counts
+func TestGatherManyExplicitRepos(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var repos []string
+	for i := 0; i < 12; i++ {
+		repos = append(repos, fmt.Sprintf("org%d/a-repository-with-a-rather-long-name-%d", i%3, i))
+	}
+	for _, repo := range repos {
+		mux.HandleFunc("/repos/"+repo, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			owner, name, _ := strings.Cut(repo, "/")
+			fmt.Fprintf(w, `{"name":%q,"full_name":%q,"owner":{"login":%q}}`, name, repo, owner)
+		})
+		mux.HandleFunc("/repos/"+repo+"/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"author":{"login":"alice"},"weeks":[{"w":1625961600,"a":1,"d":1,"c":1}]}]`))
+		})
+	}
+	var mu sync.Mutex
+	searched := map[string]int{}
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		assert.LessOrEqual(t, len(q), 256, q)
+		assert.True(t, strings.HasSuffix(q, " is:pr reviewed-by:alice created:2021-07-01..2021-09-30"), q)
+		var count int
+		mu.Lock()
+		for _, field := range strings.Fields(q) {
+			if repo, ok := strings.CutPrefix(field, "repo:"); ok {
+				searched[repo]++
+				count++
+			}
+		}
+		mu.Unlock()
+		assert.LessOrEqual(t, count, 5, q)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"total_count":%d,"items":[]}`, count)
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Repos:              repos,
+		From:               time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+		To:                 time.Date(2021, 9, 30, 0, 0, 0, 0, time.UTC),
+		AllContributors:    true,
+		IncludeReviewStats: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, searched, 12)
+	for _, repo := range repos {
+		assert.Equal(t, 1, searched[repo], repo)
+	}
+	assert.Equal(t, 12, stats.For("alice").Reviews)
+}
+
+func TestDateQualifier(t *testing.T) {
+	from := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 9, 30, 23, 59, 59, 0, time.UTC)
+
+	assert.Equal(t, "created:2021-07-01..2021-09-30", dateQualifier("created", from, to))
+	assert.Equal(t, "created:>=2021-07-01", dateQualifier("created", from, time.Time{}))
+	assert.Equal(t, "created:<=2021-09-30", dateQualifier("created", time.Time{}, to))
+	assert.Equal(t, "", dateQualifier("created", time.Time{}, time.Time{}))
+}
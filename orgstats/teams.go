@@ -0,0 +1,175 @@
+package orgstats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v39/github"
+)
+
+// Teams returns the slugs of the teams gathered along with the stats.
+func (s Stats) Teams() []string {
+	teams := make([]string, 0, len(s.teams))
+	for team := range s.teams {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// TeamMembers returns the logins of the members of the given team.
+func (s Stats) TeamMembers(team string) []string {
+	return append([]string(nil), s.teams[team]...)
+}
+
+// ForTeam returns the stats of the given team, summed across its members.
+// Bots are left out, even when included in the stats.
+func (s Stats) ForTeam(team string) Stat {
+	var total Stat
+	for _, login := range s.teams[team] {
+		if s.bots[login] {
+			continue
+		}
+		st := s.data[login]
+		total.Additions += st.Additions
+		total.Deletions += st.Deletions
+		total.Commits += st.Commits
+		total.Reviews += st.Reviews
+		total.PullRequestsOpened += st.PullRequestsOpened
+		total.PullRequestsMerged += st.PullRequestsMerged
+		total.PullRequestsClosed += st.PullRequestsClosed
+		total.IssuesOpened += st.IssuesOpened
+		total.IssuesClosed += st.IssuesClosed
+		total.IssueComments += st.IssueComments
+		total.ReviewsApproved += st.ReviewsApproved
+		total.ReviewsChangesRequested += st.ReviewsChangesRequested
+		total.ReviewsCommented += st.ReviewsCommented
+		total.ReviewComments += st.ReviewComments
+	}
+	return total
+}
+
+// gatherTeams fetches the members of the teams the options ask for: all
+// teams of the organizations if IncludeTeams is set, and the Team filter.
+// Teams are identified by their slugs, prefixed by their organization when
+// gathering several organizations.
+func gatherTeams(ctx context.Context, client *github.Client, opts Options, allStats *Stats) error {
+	if len(opts.Orgs) > 1 && opts.Team != "" && !strings.Contains(opts.Team, "/") {
+		return fmt.Errorf("team %s must be given as org/slug when gathering several organizations", opts.Team)
+	}
+
+	for _, org := range opts.Orgs {
+		var slugs []string
+		if opts.IncludeTeams {
+			var err error
+			slugs, err = getTeams(ctx, client, opts.Retry, org)
+			if err != nil {
+				return err
+			}
+		}
+		if slug, ok := teamSlug(opts, org, opts.Team); ok && !contains(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+
+		for _, slug := range slugs {
+			members, err := getTeamMembers(ctx, client, opts.Retry, org, slug)
+			if err != nil {
+				return err
+			}
+			team := slug
+			if len(opts.Orgs) > 1 {
+				team = org + "/" + slug
+			}
+			seen := map[string]bool{}
+			for _, login := range members {
+				// members are recorded under their canonical logins
+				login = allStats.identities.Resolve(login, "")
+				if !seen[login] {
+					seen[login] = true
+					allStats.teams[team] = append(allStats.teams[team], login)
+				}
+			}
+			sort.Strings(allStats.teams[team])
+		}
+	}
+	return nil
+}
+
+// teamSlug returns the slug of the given team if it belongs to org.
+func teamSlug(opts Options, org, team string) (string, bool) {
+	if team == "" {
+		return "", false
+	}
+	if len(opts.Orgs) == 1 {
+		return team, true
+	}
+	teamOrg, slug, _ := strings.Cut(team, "/")
+	return slug, strings.EqualFold(teamOrg, org)
+}
+
+// getTeams returns the slugs of all teams of the given organization.
+func getTeams(ctx context.Context, client *github.Client, retry RetryPolicy, org string) ([]string, error) {
+	opt := &github.ListOptions{PerPage: 100}
+	var slugs []string
+	for {
+		var teams []*github.Team
+		var resp *github.Response
+		if err := retry.do(ctx, "list teams of "+org, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			teams, resp, err = client.Teams.ListTeams(ctx, org, opt)
+			return resp, err
+		}); err != nil {
+			return slugs, fmt.Errorf("failed to list teams: %w", err)
+		}
+		for _, team := range teams {
+			slugs = append(slugs, team.GetSlug())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	log.Println("got", len(slugs), "teams")
+	return slugs, nil
+}
+
+// getTeamMembers returns the logins of the members of the given team,
+// including the members of its child teams.
+func getTeamMembers(ctx context.Context, client *github.Client, retry RetryPolicy, org, slug string) ([]string, error) {
+	opt := &github.TeamListTeamMembersOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var logins []string
+	for {
+		var users []*github.User
+		var resp *github.Response
+		if err := retry.do(ctx, "list members of team "+slug, func(ctx context.Context) (*github.Response, error) {
+			var err error
+			users, resp, err = client.Teams.ListTeamMembersBySlug(ctx, org, slug, opt)
+			return resp, err
+		}); err != nil {
+			return logins, fmt.Errorf("failed to list members of team %s: %w", slug, err)
+		}
+		for _, user := range users {
+			logins = append(logins, user.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return logins, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
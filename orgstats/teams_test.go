@@ -0,0 +1,125 @@
+package orgstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v39/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGatherTeams tests that stats are rolled up into teams, and that runs
+// can be restricted to a single team
+func TestGatherTeams(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"},{"login":"bob"},{"login":"carol"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"slug":"platform"},{"slug":"web"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/teams/platform/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"},{"login":"bob"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/teams/web/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"bob"},{"login":"carol"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":1,"c":1}]},
+			{"author":{"login":"bob"},"weeks":[{"w":1600000000,"a":20,"d":2,"c":2}]},
+			{"author":{"login":"carol"},"weeks":[{"w":1600000000,"a":40,"d":4,"c":4}]}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	t.Run("all teams", func(t *testing.T) {
+		stats, err := Gather(context.Background(), client, Options{
+			Orgs:         []string{"test-org"},
+			IncludeTeams: true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"platform", "web"}, stats.Teams())
+		assert.Equal(t, []string{"alice", "bob"}, stats.TeamMembers("platform"))
+		assert.Equal(t, Stat{Additions: 30, Deletions: 3, Commits: 3}, stats.ForTeam("platform"))
+		assert.Equal(t, Stat{Additions: 60, Deletions: 6, Commits: 6}, stats.ForTeam("web"))
+		assert.Equal(t, []StatPair{{"web", 6}, {"platform", 3}}, SortTeams(stats, ExtractCommits))
+		assert.Equal(t, []StatPair{{"carol", 4}, {"bob", 2}}, SortTeamMembers(stats, "web", ExtractCommits))
+	})
+
+	t.Run("single team", func(t *testing.T) {
+		stats, err := Gather(context.Background(), client, Options{
+			Orgs: []string{"test-org"},
+			Team: "platform",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"platform"}, stats.Teams())
+		assert.ElementsMatch(t, []string{"alice", "bob"}, stats.Logins())
+	})
+}
+
+// TestGatherTeamsBots tests that included bots don't count towards the
+// stats of their teams
+func TestGatherTeamsBots(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/orgs/test-org/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"},{"login":"deploy-bot"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"slug":"platform"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/teams/platform/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"login":"alice"},{"login":"deploy-bot"}]`))
+	})
+	mux.HandleFunc("/orgs/test-org/repos", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"repo","full_name":"test-org/repo","owner":{"login":"test-org"}}]`))
+	})
+	mux.HandleFunc("/repos/test-org/repo/stats/contributors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"author":{"login":"alice"},"weeks":[{"w":1600000000,"a":10,"d":1,"c":1}]},
+			{"author":{"login":"deploy-bot","type":"Bot"},"weeks":[{"w":1600000000,"a":90,"d":9,"c":9}]}
+		]`))
+	})
+
+	client := github.NewClient(nil)
+	url, _ := url.Parse(server.URL + "/")
+	client.BaseURL = url
+	client.UploadURL = url
+
+	stats, err := Gather(context.Background(), client, Options{
+		Orgs:         []string{"test-org"},
+		IncludeTeams: true,
+		IncludeBots:  true,
+	})
+	assert.NoError(t, err)
+	assert.True(t, stats.IsBot("deploy-bot"))
+	assert.Equal(t, Stat{Additions: 10, Deletions: 1, Commits: 1}, stats.ForTeam("platform"))
+	assert.Equal(t, []StatPair{{"alice", 1}}, SortTeamMembers(stats, "platform", ExtractCommits))
+}